@@ -0,0 +1,357 @@
+package authorizer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// GrantTypeAuthorizationCode ...
+	GrantTypeAuthorizationCode = "authorization_code"
+	// CodeChallengeMethodS256 the only PKCE method accepted ( RFC 7636 4.2 )
+	CodeChallengeMethodS256 = "S256"
+	// DefaultCodeTTL lifetime of the authorization codes
+	DefaultCodeTTL = time.Minute
+	// scopeOpenID an ID token is issued along the access token
+	scopeOpenID = "openid"
+)
+
+var (
+	// ErrUnknownCode ...
+	ErrUnknownCode = errors.New("unknown or used authorization code")
+	// ErrInvalidAuthorizeConfig ...
+	ErrInvalidAuthorizeConfig = errors.New("authorize endpoint needs clients, codes and an authenticate callback")
+)
+
+// AuthorizationRequest a validated authorization request ( RFC 6749 4.1.1 )
+type AuthorizationRequest struct {
+	ClientID      string
+	RedirectURI   string
+	Scopes        []string // allowed for the client, the consent callback may narrow them
+	State         string
+	Nonce         string
+	CodeChallenge string
+}
+
+// AuthorizationCode what a code stands for until it is redeemed
+type AuthorizationCode struct {
+	ClientID    string
+	RedirectURI string
+	// RedirectURIGiven the redirect_uri was in the authorization request,
+	// the token request must then repeat it ( RFC 6749 4.1.3 )
+	RedirectURIGiven bool
+	CodeChallenge    string
+	Scope            string
+	Nonce            string
+	User             *AuthClaims
+	AuthTime         time.Time
+	ExpiresAt        time.Time
+}
+
+// CodeStore single use authorization codes
+type CodeStore interface {
+	Save(ctx context.Context, code string, grant *AuthorizationCode) error
+	// Take the grant of the code and forget it, ErrUnknownCode when not found
+	Take(ctx context.Context, code string) (*AuthorizationCode, error)
+}
+
+// MemoryCodeStore in memory CodeStore
+type MemoryCodeStore struct {
+	mu    sync.Mutex
+	codes map[string]*AuthorizationCode
+}
+
+// NewMemoryCodeStore ...
+func NewMemoryCodeStore() *MemoryCodeStore {
+	return &MemoryCodeStore{codes: make(map[string]*AuthorizationCode)}
+}
+
+// Save ...
+func (m *MemoryCodeStore) Save(_ context.Context, code string, grant *AuthorizationCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for c, g := range m.codes {
+		if now.After(g.ExpiresAt) {
+			delete(m.codes, c)
+		}
+	}
+	m.codes[code] = grant
+	return nil
+}
+
+// Take ...
+func (m *MemoryCodeStore) Take(_ context.Context, code string) (*AuthorizationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	grant, ok := m.codes[code]
+	if !ok {
+		return nil, ErrUnknownCode
+	}
+	delete(m.codes, code)
+	return grant, nil
+}
+
+// ConsentResult ...
+type ConsentResult int
+
+const (
+	// ConsentPending the callback answered itself ( ie: a consent page posting back to the endpoint )
+	ConsentPending ConsentResult = iota
+	// ConsentGranted the Scopes of the request are granted
+	ConsentGranted
+	// ConsentDenied the client gets access_denied
+	ConsentDenied
+)
+
+// AuthorizeConfig of NewAuthorizeEndpoint
+type AuthorizeConfig struct {
+	Clients ClientStore
+	Codes   CodeStore
+	// Authenticate the end user, nil when the callback answered itself ( ie: a redirect to the login page )
+	Authenticate func(w http.ResponseWriter, r *http.Request, req *AuthorizationRequest) *AuthClaims
+	// Consent of the end user, everything is granted when nil ( first party apps )
+	Consent func(w http.ResponseWriter, r *http.Request, req *AuthorizationRequest, user *AuthClaims) ConsentResult
+	// CodeTTL DefaultCodeTTL when zero
+	CodeTTL time.Duration
+}
+
+// AuthorizeEndpoint authorization endpoint of the authorization code grant with mandatory PKCE S256
+// ( RFC 6749 4.1, RFC 7636 ), the codes are redeemed by a TokenEndpoint WithCodes of the same store
+type AuthorizeEndpoint struct {
+	cfg AuthorizeConfig
+}
+
+// NewAuthorizeEndpoint ...
+func NewAuthorizeEndpoint(cfg AuthorizeConfig) (*AuthorizeEndpoint, error) {
+	if cfg.Clients == nil || cfg.Codes == nil || cfg.Authenticate == nil {
+		return nil, ErrInvalidAuthorizeConfig
+	}
+	if cfg.CodeTTL <= 0 {
+		cfg.CodeTTL = DefaultCodeTTL
+	}
+	return &AuthorizeEndpoint{cfg: cfg}, nil
+}
+
+// ServeHTTP GET or POST ( ie: from the consent page ), the errors are sent back to the redirect uri
+// once it is known to belong to the client, before that they are answered with 400
+func (a *AuthorizeEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	client, err := a.cfg.Clients.Client(r.Context(), r.Form.Get("client_id"))
+	if err != nil || client == nil {
+		http.Error(w, "invalid client_id", http.StatusBadRequest)
+		return
+	}
+	redirectURI, ok := clientRedirectURI(client, r.Form.Get("redirect_uri"))
+	if !ok {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	req := &AuthorizationRequest{
+		ClientID:      client.ID,
+		RedirectURI:   redirectURI,
+		State:         r.Form.Get("state"),
+		Nonce:         r.Form.Get("nonce"),
+		CodeChallenge: r.Form.Get("code_challenge"),
+	}
+	fail := func(err *OAuthError) {
+		redirectWith(w, r, req.RedirectURI, url.Values{"error": {err.Code}, "error_description": {err.Description}, "state": {req.State}})
+	}
+	switch {
+	case r.Form.Get("response_type") != "code":
+		fail(oauthError(OAuthUnsupportedResponseType, "only code is supported"))
+		return
+	case req.CodeChallenge == "" || r.Form.Get("code_challenge_method") != CodeChallengeMethodS256:
+		fail(oauthError(OAuthInvalidRequest, "code_challenge with the S256 method is required"))
+		return
+	case len(req.CodeChallenge) != base64.RawURLEncoding.EncodedLen(sha256.Size):
+		fail(oauthError(OAuthInvalidRequest, "malformed code_challenge"))
+		return
+	}
+	scopes, err := grantScopes(client, r.Form.Get("scope"))
+	if err != nil {
+		var oerr *OAuthError
+		errors.As(err, &oerr)
+		fail(oerr)
+		return
+	}
+	req.Scopes = scopes
+
+	user := a.cfg.Authenticate(w, r, req)
+	if user == nil {
+		return
+	}
+	if a.cfg.Consent != nil {
+		switch a.cfg.Consent(w, r, req, user) {
+		case ConsentPending:
+			return
+		case ConsentDenied:
+			fail(oauthError(OAuthAccessDenied, ""))
+			return
+		}
+	}
+
+	code, err := newCode()
+	if err != nil {
+		fail(oauthError(OAuthServerError, ""))
+		return
+	}
+	now := time.Now()
+	authTime := now
+	if user.IssuedAt > 0 {
+		// the session of the end user started then
+		authTime = time.Unix(user.IssuedAt, 0)
+	}
+	if err := a.cfg.Codes.Save(r.Context(), code, &AuthorizationCode{
+		ClientID:         client.ID,
+		RedirectURI:      redirectURI,
+		RedirectURIGiven: r.Form.Get("redirect_uri") != "",
+		CodeChallenge:    req.CodeChallenge,
+		Scope:            strings.Join(req.Scopes, " "),
+		Nonce:            req.Nonce,
+		User:             user,
+		AuthTime:         authTime,
+		ExpiresAt:        now.Add(a.cfg.CodeTTL),
+	}); err != nil {
+		fail(oauthError(OAuthServerError, ""))
+		return
+	}
+	redirectWith(w, r, redirectURI, url.Values{"code": {code}, "state": {req.State}})
+}
+
+// clientRedirectURI an exact match of the registered ones, the only one when none is given
+func clientRedirectURI(client *OAuthClient, redirectURI string) (string, bool) {
+	if redirectURI == "" {
+		if len(client.RedirectURIs) == 1 {
+			return client.RedirectURIs[0], true
+		}
+		return "", false
+	}
+	return redirectURI, anyEqual(client.RedirectURIs, []string{redirectURI})
+}
+
+// sameRedirectURI required and identical when the authorization request had one, else checked only when given
+func (c *AuthorizationCode) sameRedirectURI(redirectURI string) bool {
+	if redirectURI == "" {
+		return !c.RedirectURIGiven
+	}
+	return redirectURI == c.RedirectURI
+}
+
+// redirectWith 302 to the uri with the non empty params added to its query
+func redirectWith(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	query := u.Query()
+	for k, v := range params {
+		if len(v) > 0 && v[0] != "" {
+			query.Set(k, v[0])
+		}
+	}
+	u.RawQuery = query.Encode()
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// newCode 256 random bits
+func newCode() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// authorizationCode redeem a code, with the code_verifier of its challenge and the same redirect_uri,
+// for the client it was issued to, an ID token is added for the openid scope
+func (t *TokenEndpoint) authorizationCode(r *http.Request, client *OAuthClient) (*TokenResponse, error) {
+	code, verifier := r.PostForm.Get("code"), r.PostForm.Get("code_verifier")
+	if code == "" || verifier == "" {
+		return nil, oauthError(OAuthInvalidRequest, "code and code_verifier are required")
+	}
+	grant, err := t.codes.Take(r.Context(), code)
+	switch {
+	case errors.Is(err, ErrUnknownCode):
+		return nil, oauthError(OAuthInvalidGrant, "unknown, used or expired code")
+	case err != nil:
+		return nil, oauthError(OAuthServerError, "")
+	case time.Now().After(grant.ExpiresAt):
+		return nil, oauthError(OAuthInvalidGrant, "unknown, used or expired code")
+	case grant.ClientID != client.ID:
+		return nil, oauthError(OAuthInvalidGrant, "code issued to another client")
+	case !grant.sameRedirectURI(r.PostForm.Get("redirect_uri")):
+		return nil, oauthError(OAuthInvalidGrant, "redirect_uri mismatch")
+	case !checkCodeVerifier(verifier, grant.CodeChallenge):
+		return nil, oauthError(OAuthInvalidGrant, "code_verifier mismatch")
+	}
+
+	// the user claims with a lifetime, audience and jti of the token
+	claims := &AuthClaims{}
+	if grant.User != nil {
+		*claims = *grant.User
+		claims.StandardClaims = jwt.StandardClaims{Issuer: grant.User.Issuer, Subject: grant.User.Subject}
+	}
+	claims.Scope = grant.Scope
+	resp, err := t.issue(claims, client)
+	if err != nil {
+		return nil, err
+	}
+
+	// OpenID Connect
+	if anyEqual(strings.Fields(grant.Scope), []string{scopeOpenID}) {
+		issuer, ok := t.verifier.(interface {
+			IssueIDToken(claims *AuthClaims, opts IDTokenOptions) (string, error)
+		})
+		if !ok {
+			return nil, oauthError(OAuthServerError, "")
+		}
+		if resp.IDToken, err = issuer.IssueIDToken(claims, IDTokenOptions{
+			ClientID:    client.ID,
+			Nonce:       grant.Nonce,
+			AuthTime:    grant.AuthTime,
+			AccessToken: resp.AccessToken,
+		}); err != nil {
+			return nil, oauthError(OAuthServerError, "")
+		}
+	}
+	return resp, nil
+}
+
+// checkCodeVerifier BASE64URL(SHA256(code_verifier)) == code_challenge, the verifier is 43 to 128 unreserved chars
+func checkCodeVerifier(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, c := range verifier {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', strings.ContainsRune("-._~", c):
+		default:
+			return false
+		}
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
@@ -0,0 +1,267 @@
+package authorizer_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/golang-jwt/jwt/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+	"github.com/bayugyug/authorizer/authorizertest"
+)
+
+var _ = Describe("AuthorizationCode", func() {
+
+	const (
+		redirectURI  = "https://spa.example.com/callback"
+		codeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	)
+
+	var (
+		verifier *authorizer.VerifierService
+		server   *httptest.Server
+		client   = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	)
+
+	challenge := func(verifier string) string {
+		sum := sha256.Sum256([]byte(verifier))
+		return base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	BeforeEach(func() {
+		verifier = authorizertest.NewVerifier(GinkgoT())
+		hash, err := authorizer.HashClientSecret("web-s3cret")
+		Expect(err).To(BeNil())
+		clients := authorizer.StaticClientStore{
+			"spa": {ID: "spa", Public: true, RedirectURIs: []string{redirectURI}, Scopes: []string{"openid", "orders:read"}},
+			"web": {ID: "web", SecretHash: hash, RedirectURIs: []string{"https://web.example.com/cb"}, Scopes: []string{"orders:read"}},
+		}
+		codes := authorizer.NewMemoryCodeStore()
+		authorize, err := authorizer.NewAuthorizeEndpoint(authorizer.AuthorizeConfig{
+			Clients: clients,
+			Codes:   codes,
+			Authenticate: func(w http.ResponseWriter, r *http.Request, _ *authorizer.AuthorizationRequest) *authorizer.AuthClaims {
+				if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "juan" {
+					http.Redirect(w, r, "/login?return_to="+url.QueryEscape(r.URL.String()), http.StatusFound)
+					return nil
+				}
+				return &authorizer.AuthClaims{
+					StandardClaims: jwt.StandardClaims{Subject: "user-1001"},
+					Details:        &authorizer.Details{Name: "juan", Roles: []string{"user"}},
+				}
+			},
+			Consent: func(w http.ResponseWriter, r *http.Request, req *authorizer.AuthorizationRequest, _ *authorizer.AuthClaims) authorizer.ConsentResult {
+				switch r.Form.Get("approve") {
+				case "yes":
+					return authorizer.ConsentGranted
+				case "no":
+					return authorizer.ConsentDenied
+				}
+				fmt.Fprintf(w, "allow %s to %s?", req.ClientID, strings.Join(req.Scopes, ", "))
+				return authorizer.ConsentPending
+			},
+		})
+		Expect(err).To(BeNil())
+
+		r := chi.NewRouter()
+		r.Method(http.MethodGet, "/authorize", authorize)
+		r.Method(http.MethodPost, "/authorize", authorize)
+		server = httptest.NewServer(r)
+		r.Method(http.MethodPost, "/token", authorizer.NewTokenEndpoint(verifier, clients, server.URL+"/token").WithCodes(codes))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	authorizeURL := func(params url.Values) string {
+		base := url.Values{
+			"response_type":         {"code"},
+			"client_id":             {"spa"},
+			"redirect_uri":          {redirectURI},
+			"scope":                 {"openid orders:read"},
+			"state":                 {"xyz"},
+			"nonce":                 {"n-0S6_WzA2Mj"},
+			"code_challenge":        {challenge(codeVerifier)},
+			"code_challenge_method": {"S256"},
+		}
+		for k, v := range params {
+			base[k] = v
+		}
+		return server.URL + "/authorize?" + base.Encode()
+	}
+	authorize := func(target string, loggedIn bool) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		Expect(err).To(BeNil())
+		if loggedIn {
+			req.AddCookie(&http.Cookie{Name: "session", Value: "juan"})
+		}
+		resp, err := client.Do(req)
+		Expect(err).To(BeNil())
+		_ = resp.Body.Close()
+		return resp
+	}
+	redirected := func(resp *http.Response) url.Values {
+		Expect(resp.StatusCode).To(Equal(http.StatusFound))
+		location, err := url.Parse(resp.Header.Get("Location"))
+		Expect(err).To(BeNil())
+		return location.Query()
+	}
+	exchange := func(form url.Values) (int, map[string]interface{}) {
+		resp, err := client.PostForm(server.URL+"/token", form)
+		Expect(err).To(BeNil())
+		defer resp.Body.Close()
+		body := map[string]interface{}{}
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		return resp.StatusCode, body
+	}
+	codeForm := func(code, verifier string) url.Values {
+		return url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {"spa"},
+			"code":          {code},
+			"redirect_uri":  {redirectURI},
+			"code_verifier": {verifier},
+		}
+	}
+
+	Context("Login, consent and code exchange", func() {
+		It("Prepare", func() {
+
+			By("the login page first")
+			resp := authorize(authorizeURL(nil), false)
+			Expect(resp.StatusCode).To(Equal(http.StatusFound))
+			Expect(resp.Header.Get("Location")).To(HavePrefix("/login?return_to="))
+
+			By("then the consent page")
+			resp = authorize(authorizeURL(nil), true)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			query := redirected(authorize(authorizeURL(url.Values{"approve": {"yes"}}), true))
+			Expect(query.Get("state")).To(Equal("xyz"))
+			code := query.Get("code")
+			Expect(code).NotTo(BeEmpty())
+
+			status, body := exchange(codeForm(code, codeVerifier))
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body["token_type"]).To(Equal("Bearer"))
+			Expect(body["scope"]).To(Equal("openid orders:read"))
+
+			claims, err := verifier.Verify(body["access_token"].(string))
+			Expect(err).To(BeNil())
+			Expect(claims.Subject).To(Equal("user-1001"))
+			Expect(claims.HasScope("orders:read")).To(BeTrue())
+			Expect(claims.HasRole("user")).To(BeTrue())
+
+			idClaims := &authorizer.IDTokenClaims{}
+			_, _, err = jwt.NewParser().ParseUnverified(body["id_token"].(string), idClaims)
+			Expect(err).To(BeNil())
+			Expect(idClaims.Audience).To(Equal("spa"))
+			Expect(idClaims.Nonce).To(Equal("n-0S6_WzA2Mj"))
+			Expect(idClaims.Name).To(Equal("juan"))
+			Expect(idClaims.AtHash).NotTo(BeEmpty())
+
+			By("the code is single use")
+			status, body = exchange(codeForm(code, codeVerifier))
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(body["error"]).To(Equal("invalid_grant"))
+
+			By("Login, consent and code exchange ok")
+		})
+	})
+
+	Context("PKCE", func() {
+		It("Prepare", func() {
+
+			code := redirected(authorize(authorizeURL(url.Values{"approve": {"yes"}}), true)).Get("code")
+			status, body := exchange(codeForm(code, strings.Repeat("a", 43)))
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(body["error"]).To(Equal("invalid_grant"))
+
+			By("the challenge is mandatory and S256 only")
+			query := redirected(authorize(authorizeURL(url.Values{"code_challenge": {""}}), true))
+			Expect(query.Get("error")).To(Equal("invalid_request"))
+			Expect(query.Get("state")).To(Equal("xyz"))
+			query = redirected(authorize(authorizeURL(url.Values{"code_challenge_method": {"plain"}}), true))
+			Expect(query.Get("error")).To(Equal("invalid_request"))
+
+			By("PKCE ok")
+		})
+	})
+
+	Context("redirect_uri of the token request", func() {
+		It("Prepare", func() {
+
+			By("not needed when the authorization request had none")
+			code := redirected(authorize(authorizeURL(url.Values{"approve": {"yes"}, "redirect_uri": {""}}), true)).Get("code")
+			form := codeForm(code, codeVerifier)
+			form.Del("redirect_uri")
+			status, _ := exchange(form)
+			Expect(status).To(Equal(http.StatusOK))
+
+			By("but checked when given")
+			code = redirected(authorize(authorizeURL(url.Values{"approve": {"yes"}, "redirect_uri": {""}}), true)).Get("code")
+			form = codeForm(code, codeVerifier)
+			form.Set("redirect_uri", "https://spa.example.com/other")
+			status, body := exchange(form)
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(body["error"]).To(Equal("invalid_grant"))
+
+			By("required when the authorization request had one")
+			code = redirected(authorize(authorizeURL(url.Values{"approve": {"yes"}}), true)).Get("code")
+			form = codeForm(code, codeVerifier)
+			form.Del("redirect_uri")
+			status, body = exchange(form)
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(body["error"]).To(Equal("invalid_grant"))
+
+			By("redirect_uri of the token request ok")
+		})
+	})
+
+	Context("Authorization errors", func() {
+		It("Prepare", func() {
+
+			By("unknown clients and redirect uris are not redirected to")
+			Expect(authorize(authorizeURL(url.Values{"client_id": {"nobody"}}), true).StatusCode).To(Equal(http.StatusBadRequest))
+			Expect(authorize(authorizeURL(url.Values{"redirect_uri": {"https://evil.example.com/cb"}}), true).StatusCode).To(Equal(http.StatusBadRequest))
+
+			Expect(redirected(authorize(authorizeURL(url.Values{"approve": {"no"}}), true)).Get("error")).To(Equal("access_denied"))
+			Expect(redirected(authorize(authorizeURL(url.Values{"scope": {"admin"}}), true)).Get("error")).To(Equal("invalid_scope"))
+			Expect(redirected(authorize(authorizeURL(url.Values{"response_type": {"token"}}), true)).Get("error")).To(Equal("unsupported_response_type"))
+
+			By("a code of another client or redirect uri")
+			code := redirected(authorize(authorizeURL(url.Values{"approve": {"yes"}}), true)).Get("code")
+			form := codeForm(code, codeVerifier)
+			form.Set("redirect_uri", "https://spa.example.com/other")
+			status, body := exchange(form)
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(body["error"]).To(Equal("invalid_grant"))
+
+			code = redirected(authorize(authorizeURL(url.Values{"approve": {"yes"}}), true)).Get("code")
+			form = codeForm(code, codeVerifier)
+			form.Del("client_id")
+			form.Set("client_id", "web")
+			form.Set("client_secret", "web-s3cret")
+			status, body = exchange(form)
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(body["error"]).To(Equal("invalid_grant"))
+
+			By("public clients have no client credentials grant")
+			status, body = exchange(url.Values{"grant_type": {"client_credentials"}, "client_id": {"spa"}})
+			Expect(status).To(Equal(http.StatusUnauthorized))
+			Expect(body["error"]).To(Equal("invalid_client"))
+
+			By("Authorization errors ok")
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package authorizertest_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestAuthorizertest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Authorizertest Suite")
+}
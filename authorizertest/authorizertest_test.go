@@ -0,0 +1,157 @@
+package authorizertest_test
+
+import (
+	"crypto/elliptic"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+	"github.com/bayugyug/authorizer/authorizertest"
+)
+
+var _ = Describe("Authorizertest", func() {
+
+	var (
+		verifier *authorizer.VerifierService
+		tokens   *authorizertest.TokenFactory
+	)
+
+	BeforeEach(func() {
+		verifier = authorizertest.NewVerifier(GinkgoT())
+		tokens = authorizertest.NewTokenFactory(GinkgoT(), verifier)
+	})
+
+	Context("Token variants", func() {
+		It("Prepare", func() {
+
+			res, err := verifier.Verify(tokens.Valid(authorizertest.WithSubject("user-1001"), authorizertest.WithRoles("admin")))
+			Expect(err).To(BeNil())
+			Expect(res.Subject).To(Equal("user-1001"))
+			Expect(res.Details.Roles).To(Equal([]string{"admin"}))
+			Expect(res.Issuer).To(Equal("authorizertest"))
+
+			_, err = verifier.Verify(tokens.Expired())
+			Expect(err).NotTo(BeNil())
+			Expect(err.(*jwt.ValidationError).Errors & jwt.ValidationErrorExpired).NotTo(BeZero())
+
+			_, err = verifier.Verify(tokens.NotYetValid())
+			Expect(err).NotTo(BeNil())
+			Expect(err.(*jwt.ValidationError).Errors & jwt.ValidationErrorNotValidYet).NotTo(BeZero())
+
+			_, err = verifier.Verify(tokens.WrongKey())
+			Expect(err).NotTo(BeNil())
+			Expect(err.(*jwt.ValidationError).Errors & jwt.ValidationErrorSignatureInvalid).NotTo(BeZero())
+
+			By("Token variants ok")
+		})
+	})
+
+	Context("Requests through every token source", func() {
+		It("Prepare", func() {
+
+			for _, src := range []authorizer.TokenSource{
+				{AuthBearer: true},
+				{HeaderKey: "X-CI-Token"},
+				{QueryKey: "_verify"},
+			} {
+				svc := authorizertest.NewVerifier(GinkgoT(), authorizer.WithTokenSource(src))
+				token := authorizertest.NewTokenFactory(GinkgoT(), svc).Valid()
+
+				req := authorizertest.NewRequest(http.MethodGet, "/get?keep=1", nil, src, token)
+				_, err := svc.UnSign(req)
+				Expect(err).To(BeNil())
+				Expect(req.URL.Query().Get("keep")).To(Equal("1"))
+			}
+
+			By("Requests through every token source ok")
+		})
+	})
+
+	Context("Key pairs", func() {
+		It("Prepare", func() {
+
+			keys := authorizertest.NewECKeyPair(GinkgoT(), elliptic.P256())
+			Expect(strings.Contains(keys.PrivateKey, "EC PRIVATE KEY")).To(BeTrue())
+
+			svc, err := authorizer.New(
+				authorizer.WithKeys(keys.PrivateKey, keys.PublicKey),
+				authorizer.WithTokenSource(authorizertest.DefaultTokenSource),
+			)
+			Expect(err).To(BeNil())
+			_, err = svc.Verify(authorizertest.NewTokenFactory(GinkgoT(), svc).Valid())
+			Expect(err).To(BeNil())
+
+			By("Key pairs ok")
+		})
+	})
+
+	Context("Fake verifier in a handler", func() {
+		It("Prepare", func() {
+
+			fake := authorizertest.NewFake().
+				AddToken("admin-token", &authorizer.AuthClaims{
+					Details: &authorizer.Details{Roles: []string{"admin"}},
+				}).
+				AddError("revoked-token", authorizer.ErrRevokedToken)
+
+			var svc authorizer.VerifierServiceCreator = fake
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				claims, err := svc.UnSign(r)
+				if err != nil {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				if claims.Details == nil || len(claims.Details.Roles) == 0 || claims.Details.Roles[0] != "admin" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+
+			for token, code := range map[string]int{
+				"admin-token":   http.StatusOK,
+				"revoked-token": http.StatusUnauthorized,
+				"unknown-token": http.StatusUnauthorized,
+			} {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, authorizertest.NewRequest(http.MethodGet, "/get", nil, authorizertest.DefaultTokenSource, token))
+				Expect(w.Code).To(Equal(code), token)
+			}
+			Expect(fake.CallCount("UnSign")).To(Equal(3))
+
+			// sign then verify round trip without any key
+			token, err := fake.Sign(&authorizer.AuthClaims{Details: &authorizer.Details{Roles: []string{"user"}}})
+			Expect(err).To(BeNil())
+			results := fake.VerifyBatch([]string{token, "", "admin-token"})
+			Expect(results[0].Claims.Details.Roles).To(Equal([]string{"user"}))
+			Expect(results[1].Err).To(Equal(authorizer.ErrEmptyToken))
+			Expect(results[2].Err).To(BeNil())
+
+			calls := fake.Calls()
+			Expect(calls[len(calls)-2].Err).To(Equal(authorizer.ErrEmptyToken))
+
+			fake.SignErr = authorizer.ErrMissingPrivateKey
+			_, err = fake.Sign(&authorizer.AuthClaims{})
+			Expect(err).To(Equal(authorizer.ErrMissingPrivateKey))
+
+			// a zero Fake works as well
+			zero := &authorizertest.Fake{}
+			_, err = zero.Verify("admin-token")
+			Expect(err).NotTo(BeNil())
+			zero.AddToken("admin-token", &authorizer.AuthClaims{})
+			_, err = zero.Verify("admin-token")
+			Expect(err).To(BeNil())
+			token, err = (&authorizertest.Fake{}).Sign(&authorizer.AuthClaims{})
+			Expect(err).To(BeNil())
+			Expect(token).NotTo(BeEmpty())
+
+			By("Fake verifier in a handler ok")
+		})
+	})
+})
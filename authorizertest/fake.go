@@ -0,0 +1,182 @@
+package authorizertest
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/bayugyug/authorizer"
+)
+
+// verify the interfaces
+var (
+	_ authorizer.VerifierServiceCreator = (*Fake)(nil)
+	_ authorizer.BatchVerifier          = (*Fake)(nil)
+)
+
+// Call one recorded call of the fake
+type Call struct {
+	Method string // Sign, UnSign, Verify or VerifyBatch
+	Token  string
+	Claims *authorizer.AuthClaims
+	Err    error
+}
+
+// Fake in-memory VerifierServiceCreator, opaque tokens map to preset claims or errors
+type Fake struct {
+	// TokenSource where UnSign looks for the token, DefaultTokenSource when empty
+	TokenSource authorizer.TokenSource
+	// SignErr returned by every Sign when set
+	SignErr error
+
+	mu     sync.Mutex
+	tokens map[string]fakeToken
+	calls  []Call
+	seq    int
+}
+
+// fakeToken ...
+type fakeToken struct {
+	claims *authorizer.AuthClaims
+	err    error
+}
+
+// NewFake ... a zero Fake works as well
+func NewFake() *Fake {
+	return &Fake{
+		tokens: make(map[string]fakeToken),
+	}
+}
+
+// AddToken the token verifies to a copy of the claims
+func (f *Fake) AddToken(token string, claims *authorizer.AuthClaims) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setToken(token, fakeToken{claims: copyClaims(claims)})
+	return f
+}
+
+// AddError the token fails with err
+func (f *Fake) AddError(token string, err error) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setToken(token, fakeToken{err: err})
+	return f
+}
+
+// setToken the map is made on the first write, the lock is held
+func (f *Fake) setToken(token string, entry fakeToken) {
+	if f.tokens == nil {
+		f.tokens = make(map[string]fakeToken)
+	}
+	f.tokens[token] = entry
+}
+
+// Sign register the claims under a new opaque token
+func (f *Fake) Sign(claims *authorizer.AuthClaims, _ ...authorizer.SignOptions) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	call := Call{Method: "Sign", Claims: copyClaims(claims)}
+	switch {
+	case f.SignErr != nil:
+		call.Err = f.SignErr
+	case claims == nil:
+		call.Err = authorizer.ErrMissingParams
+	default:
+		f.seq++
+		call.Token = fmt.Sprintf("fake-token-%d", f.seq)
+		f.setToken(call.Token, fakeToken{claims: copyClaims(claims)})
+	}
+	f.calls = append(f.calls, call)
+	return call.Token, call.Err
+}
+
+// UnSign look up the token found through the TokenSource
+func (f *Fake) UnSign(req *http.Request) (*authorizer.AuthClaims, error) {
+	src := f.TokenSource
+	if src == (authorizer.TokenSource{}) {
+		src = DefaultTokenSource
+	}
+	var token string
+	if src.AuthBearer {
+		token = authorizer.GetTokenFromAuthBearer(req)
+	}
+	if src.HeaderKey != "" && token == "" {
+		token = authorizer.GetTokenFromHeader(req, src.HeaderKey)
+	}
+	if src.QueryKey != "" && token == "" {
+		token = authorizer.GetTokenFromQuery(req, src.QueryKey)
+	}
+	return f.lookup("UnSign", token)
+}
+
+// Verify look up the token
+func (f *Fake) Verify(token string) (*authorizer.AuthClaims, error) {
+	return f.lookup("Verify", token)
+}
+
+// VerifyBatch look up every token in order
+func (f *Fake) VerifyBatch(tokens []string) []authorizer.VerifyResult[interface{}] {
+	results := make([]authorizer.VerifyResult[interface{}], len(tokens))
+	for i, token := range tokens {
+		claims, err := f.lookup("VerifyBatch", token)
+		results[i] = authorizer.VerifyResult[interface{}]{Claims: claims, Err: err}
+	}
+	return results
+}
+
+// Calls every recorded call in order
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// CallCount number of calls of the method
+func (f *Fake) CallCount(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	for _, call := range f.calls {
+		if call.Method == method {
+			count++
+		}
+	}
+	return count
+}
+
+// lookup unknown tokens are invalid, empty ones are missing
+func (f *Fake) lookup(method, token string) (*authorizer.AuthClaims, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	call := Call{Method: method, Token: token}
+	entry, ok := f.tokens[token]
+	switch {
+	case token == "":
+		call.Err = authorizer.ErrEmptyToken
+	case !ok:
+		call.Err = authorizer.ErrInvalidToken
+	case entry.err != nil:
+		call.Err = entry.err
+	default:
+		call.Claims = copyClaims(entry.claims)
+	}
+	f.calls = append(f.calls, call)
+	return copyClaims(call.Claims), call.Err
+}
+
+// copyClaims ...
+func copyClaims(claims *authorizer.AuthClaims) *authorizer.AuthClaims {
+	if claims == nil {
+		return nil
+	}
+	clone := *claims
+	if claims.Details != nil {
+		details := *claims.Details
+		details.Roles = append([]string(nil), claims.Details.Roles...)
+		clone.Details = &details
+	}
+	return &clone
+}
@@ -0,0 +1,62 @@
+package authorizertest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+)
+
+// TestingT the subset of testing.TB used by the helpers ( GinkgoT() works too )
+type TestingT interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+}
+
+// KeyPair pem encoded private/public keys
+type KeyPair struct {
+	PrivateKey string
+	PublicKey  string
+}
+
+// NewRSAKeyPair ephemeral rsa keys
+func NewRSAKeyPair(t TestingT, bits int) KeyPair {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatalf("authorizertest: generate rsa key: %v", err)
+	}
+	return KeyPair{
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		})),
+		PublicKey: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PUBLIC KEY",
+			Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey),
+		})),
+	}
+}
+
+// NewECKeyPair ephemeral ecdsa keys
+func NewECKeyPair(t TestingT, curve elliptic.Curve) KeyPair {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatalf("authorizertest: generate ecdsa key: %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("authorizertest: marshal ecdsa key: %v", err)
+	}
+	pubDer, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("authorizertest: marshal ecdsa public key: %v", err)
+	}
+	return KeyPair{
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})),
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer})),
+	}
+}
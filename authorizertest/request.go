@@ -0,0 +1,29 @@
+package authorizertest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/bayugyug/authorizer"
+)
+
+// AttachToken put the token where the source expects it: bearer, then header, then query
+func AttachToken(req *http.Request, src authorizer.TokenSource, token string) *http.Request {
+	switch {
+	case src.AuthBearer:
+		req.Header.Set("Authorization", "Bearer "+token)
+	case src.HeaderKey != "":
+		req.Header.Set(src.HeaderKey, token)
+	case src.QueryKey != "":
+		query := req.URL.Query()
+		query.Set(src.QueryKey, token)
+		req.URL.RawQuery = query.Encode()
+	}
+	return req
+}
+
+// NewRequest httptest request carrying the token
+func NewRequest(method, target string, body io.Reader, src authorizer.TokenSource, token string) *http.Request {
+	return AttachToken(httptest.NewRequest(method, target, body), src, token)
+}
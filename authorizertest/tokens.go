@@ -0,0 +1,112 @@
+package authorizertest
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/bayugyug/authorizer"
+)
+
+// ClaimsOption tweak the default claims of the factory
+type ClaimsOption func(claims *authorizer.AuthClaims)
+
+// WithSubject ...
+func WithSubject(subject string) ClaimsOption {
+	return func(claims *authorizer.AuthClaims) {
+		claims.Subject = subject
+	}
+}
+
+// WithRoles ...
+func WithRoles(roles ...string) ClaimsOption {
+	return func(claims *authorizer.AuthClaims) {
+		claims.Details.Roles = roles
+	}
+}
+
+// WithMetaInfo ...
+func WithMetaInfo(meta interface{}) ClaimsOption {
+	return func(claims *authorizer.AuthClaims) {
+		claims.MetaInfo = meta
+	}
+}
+
+// TokenFactory sign test tokens with sensible defaults
+type TokenFactory struct {
+	t        TestingT
+	verifier *authorizer.VerifierService
+	wrongKey *authorizer.VerifierService
+}
+
+// NewTokenFactory ...
+func NewTokenFactory(t TestingT, verifier *authorizer.VerifierService) *TokenFactory {
+	return &TokenFactory{
+		t:        t,
+		verifier: verifier,
+	}
+}
+
+// Claims the default claims with the options applied
+func (f *TokenFactory) Claims(opts ...ClaimsOption) *authorizer.AuthClaims {
+	claims := &authorizer.AuthClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject: "authorizertest-subject",
+		},
+		Details: &authorizer.Details{
+			UUID:  "authorizertest-uuid",
+			Name:  "authorizertest",
+			Roles: []string{"user"},
+		},
+	}
+	for _, opt := range opts {
+		opt(claims)
+	}
+	return claims
+}
+
+// Valid ...
+func (f *TokenFactory) Valid(opts ...ClaimsOption) string {
+	f.t.Helper()
+	return f.sign(f.verifier, f.Claims(opts...))
+}
+
+// Expired expired an hour ago
+func (f *TokenFactory) Expired(opts ...ClaimsOption) string {
+	f.t.Helper()
+	now := time.Now()
+	claims := f.Claims(opts...)
+	claims.IssuedAt = now.Add(-2 * time.Hour).Unix()
+	claims.NotBefore = claims.IssuedAt
+	claims.ExpiresAt = now.Add(-time.Hour).Unix()
+	return f.sign(f.verifier, claims)
+}
+
+// NotYetValid usable in an hour
+func (f *TokenFactory) NotYetValid(opts ...ClaimsOption) string {
+	f.t.Helper()
+	now := time.Now()
+	claims := f.Claims(opts...)
+	claims.NotBefore = now.Add(time.Hour).Unix()
+	claims.ExpiresAt = now.Add(2 * time.Hour).Unix()
+	return f.sign(f.verifier, claims)
+}
+
+// WrongKey valid claims signed by an unrelated key
+func (f *TokenFactory) WrongKey(opts ...ClaimsOption) string {
+	f.t.Helper()
+	if f.wrongKey == nil {
+		f.wrongKey = NewVerifier(f.t)
+	}
+	return f.sign(f.wrongKey, f.Claims(opts...))
+}
+
+// sign ...
+func (f *TokenFactory) sign(verifier *authorizer.VerifierService, claims *authorizer.AuthClaims) string {
+	f.t.Helper()
+	token, err := verifier.Sign(claims)
+	if err != nil {
+		f.t.Fatalf("authorizertest: sign: %v", err)
+	}
+	return token
+}
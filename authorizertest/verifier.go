@@ -0,0 +1,30 @@
+// Package authorizertest helpers for tests of authorizer consumers: ephemeral keys,
+// a ready VerifierService, a token factory and requests carrying a token.
+package authorizertest
+
+import (
+	"github.com/bayugyug/authorizer"
+)
+
+// DefaultTokenSource bearer token, the X-AuthVerifierToken header and the ?verifier= query
+var DefaultTokenSource = authorizer.TokenSource{
+	AuthBearer: true,
+	HeaderKey:  authorizer.DefaultAuthHeaderKey,
+	QueryKey:   authorizer.DefaultGetQueryParam,
+}
+
+// NewVerifier ready service on fresh RSA-2048 keys, opts are applied on top
+func NewVerifier(t TestingT, opts ...authorizer.Option) *authorizer.VerifierService {
+	t.Helper()
+	keys := NewRSAKeyPair(t, 2048)
+	verifier, err := authorizer.New(append([]authorizer.Option{
+		authorizer.WithKeys(keys.PrivateKey, keys.PublicKey),
+		authorizer.WithTokenSource(DefaultTokenSource),
+		authorizer.WithIssuer("authorizertest"),
+		authorizer.WithAudience("authorizertest"),
+	}, opts...)...)
+	if err != nil {
+		t.Fatalf("authorizertest: new verifier: %v", err)
+	}
+	return verifier
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"time"
 
@@ -317,7 +318,8 @@ var _ = Describe("Authverifier", func() {
 				TokenSource: authorizer.TokenSource{
 					QueryKey: "_verify",
 				},
-				Expiry: 1400,
+				Expiry:      1400,
+				SaltSubject: true,
 			}
 			verifier = authorizer.NewVerifierService(&opts)
 			Expect(verifier).NotTo(BeNil())
@@ -392,7 +394,8 @@ var _ = Describe("Authverifier", func() {
 				TokenSource: authorizer.TokenSource{
 					HeaderKey: "X-AuthVerify-UUID",
 				},
-				Expiry: 1400,
+				Expiry:      1400,
+				SaltSubject: true,
 			}
 			verifier = authorizer.NewVerifierService(&opts)
 			Expect(verifier).NotTo(BeNil())
@@ -469,7 +472,8 @@ var _ = Describe("Authverifier", func() {
 				TokenSource: authorizer.TokenSource{
 					AuthBearer: true,
 				},
-				Expiry: 1400,
+				Expiry:      1400,
+				SaltSubject: true,
 			}
 			verifier = authorizer.NewVerifierService(&opts)
 			Expect(verifier).NotTo(BeNil())
@@ -606,6 +610,116 @@ var _ = Describe("Authverifier", func() {
 		})
 	})
 
+	Context("Sign payload with defaults", func() {
+		It("Prepare", func() {
+
+			opts := authorizer.Options{
+				PrivateKey: privKeyStr,
+				PublicKey:  pubKeyStr,
+				TokenSource: authorizer.TokenSource{
+					QueryKey: "_verify",
+				},
+				Issuer:   "ci-default-iss",
+				Audience: "ci-default-aud",
+			}
+			verifier = authorizer.NewVerifierService(&opts)
+			Expect(verifier).NotTo(BeNil())
+
+			// service defaults
+			sign, err := verifier.Sign(&authorizer.AuthClaims{})
+			Expect(err).To(BeNil())
+
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/get?_verify=%s", url.QueryEscape(sign)), nil)
+			res, err := verifier.UnSign(req)
+			Expect(err).To(BeNil())
+			Expect(res.Issuer).To(Equal("ci-default-iss"))
+			Expect(res.Audience).To(Equal("ci-default-aud"))
+			Expect(res.Id).NotTo(BeEmpty())
+			Expect(res.IssuedAt).Should(BeNumerically(">", 0))
+			Expect(res.NotBefore).Should(BeNumerically(">", 0))
+			Expect(res.ExpiresAt).Should(BeNumerically(">", res.IssuedAt))
+
+			// per call overrides
+			sign, err = verifier.Sign(&authorizer.AuthClaims{}, authorizer.SignOptions{
+				Issuer:   "ci-override-iss",
+				Audience: "ci-override-aud",
+				ID:       "ci-jti",
+				TTL:      time.Minute,
+			})
+			Expect(err).To(BeNil())
+
+			req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/get?_verify=%s", url.QueryEscape(sign)), nil)
+			res, err = verifier.UnSign(req)
+			Expect(err).To(BeNil())
+			Expect(res.Issuer).To(Equal("ci-override-iss"))
+			Expect(res.Audience).To(Equal("ci-override-aud"))
+			Expect(res.Id).To(Equal("ci-jti"))
+			Expect(res.ExpiresAt - res.IssuedAt).To(BeNumerically("==", 60))
+
+			// payload wins
+			sign, err = verifier.Sign(&authorizer.AuthClaims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer: "ci-payload-iss",
+				},
+			}, authorizer.SignOptions{Issuer: "ci-override-iss"})
+			Expect(err).To(BeNil())
+
+			req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/get?_verify=%s", url.QueryEscape(sign)), nil)
+			res, err = verifier.UnSign(req)
+			Expect(err).To(BeNil())
+			Expect(res.Issuer).To(Equal("ci-payload-iss"))
+
+			By("Sign payload with defaults ok")
+		})
+	})
+
+	Context("Sign does not mutate and salting is opt-in", func() {
+		It("Prepare", func() {
+
+			opts := authorizer.Options{
+				PrivateKey: privKeyStr,
+				PublicKey:  pubKeyStr,
+				TokenSource: authorizer.TokenSource{
+					QueryKey: "_verify",
+				},
+			}
+			verifier = authorizer.NewVerifierService(&opts)
+			Expect(verifier).NotTo(BeNil())
+			Expect(opts.Expiry).To(Equal(0))
+
+			claims := &authorizer.AuthClaims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:  "ci-test",
+					Subject: "user-1001",
+				},
+			}
+
+			// plain subject
+			sign, err := verifier.Sign(claims)
+			Expect(err).To(BeNil())
+			Expect(claims.Subject).To(Equal("user-1001"))
+			Expect(claims.ExpiresAt).To(BeNumerically("==", 0))
+			Expect(claims.Id).To(BeEmpty())
+
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/get?_verify=%s", url.QueryEscape(sign)), nil)
+			res, err := verifier.UnSign(req)
+			Expect(err).To(BeNil())
+			Expect(res.Subject).To(Equal("user-1001"))
+
+			// same claims value reused with an explicit salt
+			sign, err = verifier.Sign(claims, authorizer.SignOptions{Salt: salt})
+			Expect(err).To(BeNil())
+			Expect(claims.Subject).To(Equal("user-1001"))
+
+			req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/get?_verify=%s", url.QueryEscape(sign)), nil)
+			res, err = verifier.UnSign(req)
+			Expect(err).To(BeNil())
+			Expect(res.CheckSubject(salt)).To(BeTrue())
+
+			By("Sign does not mutate and salting is opt-in ok")
+		})
+	})
+
 	Context("Generic", func() {
 		It("Prepare", func() {
 
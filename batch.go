@@ -0,0 +1,44 @@
+package authorizer
+
+import (
+	"sync"
+)
+
+// VerifyResult outcome of one token of a batch
+type VerifyResult[T any] struct {
+	Claims *Claims[T]
+	Err    error
+}
+
+// VerifyBatch verify the tokens with a bounded worker pool, results are in the same order
+func (s *TypedVerifierService[T]) VerifyBatch(tokens []string) []VerifyResult[T] {
+	results := make([]VerifyResult[T], len(tokens))
+	if len(tokens) == 0 {
+		return results
+	}
+
+	workers := s.opts.BatchWorkers
+	if workers > len(tokens) {
+		workers = len(tokens)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				claims, err := s.Verify(tokens[i])
+				results[i] = VerifyResult[T]{Claims: claims, Err: err}
+			}
+		}()
+	}
+	for i := range tokens {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,95 @@
+package authorizer_test
+
+import (
+	"crypto/elliptic"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+)
+
+var _ = Describe("Batch", func() {
+
+	Context("Verify batch keeps the order", func() {
+		It("Prepare", func() {
+
+			privKeyStr, pubKeyStr := newKeyPair(2048)
+			verifier, err := authorizer.New(
+				authorizer.WithKeys(privKeyStr, pubKeyStr),
+				authorizer.WithTokenSource(authorizer.TokenSource{AuthBearer: true}),
+				authorizer.WithBatchWorkers(3),
+			)
+			Expect(err).To(BeNil())
+
+			tokens := make([]string, 20)
+			for i := range tokens {
+				tokens[i], err = verifier.Sign(&authorizer.AuthClaims{
+					StandardClaims: jwt.StandardClaims{Id: fmt.Sprintf("jti-%d", i)},
+				})
+				Expect(err).To(BeNil())
+			}
+			tokens[5] = tokens[5] + "x"
+			tokens[11] = ""
+
+			results := verifier.VerifyBatch(tokens)
+			Expect(results).To(HaveLen(len(tokens)))
+			for i, res := range results {
+				switch i {
+				case 5:
+					Expect(res.Err).NotTo(BeNil())
+				case 11:
+					Expect(res.Err).To(Equal(authorizer.ErrEmptyToken))
+				default:
+					Expect(res.Err).To(BeNil())
+					Expect(res.Claims.Id).To(Equal(fmt.Sprintf("jti-%d", i)))
+				}
+			}
+			Expect(verifier.VerifyBatch(nil)).To(BeEmpty())
+
+			By("Verify batch keeps the order ok")
+		})
+	})
+
+	Context("ECDSA keys", func() {
+		It("Prepare", func() {
+
+			for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+				privKeyStr, pubKeyStr := newECKeyPair(curve)
+				verifier, err := authorizer.New(
+					authorizer.WithKeys(privKeyStr, pubKeyStr),
+					authorizer.WithTokenSource(authorizer.TokenSource{AuthBearer: true}),
+				)
+				Expect(err).To(BeNil())
+
+				sign, err := verifier.Sign(&authorizer.AuthClaims{})
+				Expect(err).To(BeNil())
+
+				req := httptest.NewRequest(http.MethodGet, "/get", nil)
+				req.Header.Set("Authorization", "Bearer "+sign)
+				_, err = verifier.UnSign(req)
+				Expect(err).To(BeNil())
+			}
+
+			// rsa token on an ecdsa verifier
+			rsaPriv, _ := newKeyPair(2048)
+			ecPriv, ecPub := newECKeyPair(elliptic.P256())
+			_, err := authorizer.New(
+				authorizer.WithKeys(ecPriv, ecPub),
+				authorizer.WithTokenSource(authorizer.TokenSource{AuthBearer: true}),
+			)
+			Expect(err).To(BeNil())
+			sign, err := authorizer.NewVerifierService(&authorizer.Options{PrivateKey: rsaPriv}).Sign(&authorizer.AuthClaims{})
+			Expect(err).To(BeNil())
+			_, err = authorizer.NewTypedVerifierService[interface{}](&authorizer.Options{PublicKey: ecPub}).Verify(sign)
+			Expect(err).NotTo(BeNil())
+
+			By("ECDSA keys ok")
+		})
+	})
+})
@@ -0,0 +1,133 @@
+package authorizer_test
+
+import (
+	"crypto/elliptic"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bayugyug/authorizer"
+)
+
+// benchKeys key types and sizes covered by the benchmarks
+var benchKeys = []struct {
+	name string
+	keys func() (string, string)
+}{
+	{"RSA-2048", func() (string, string) { return newKeyPair(2048) }},
+	{"RSA-3072", func() (string, string) { return newKeyPair(3072) }},
+	{"RSA-4096", func() (string, string) { return newKeyPair(4096) }},
+	{"EC-P256", func() (string, string) { return newECKeyPair(elliptic.P256()) }},
+	{"EC-P384", func() (string, string) { return newECKeyPair(elliptic.P384()) }},
+	{"EC-P521", func() (string, string) { return newECKeyPair(elliptic.P521()) }},
+}
+
+// benchVerifier ...
+func benchVerifier(b *testing.B, keys func() (string, string), opts ...authorizer.Option) (*authorizer.VerifierService, string) {
+	b.Helper()
+	privKeyStr, pubKeyStr := keys()
+	verifier, err := authorizer.New(append([]authorizer.Option{
+		authorizer.WithKeys(privKeyStr, pubKeyStr),
+		authorizer.WithTokenSource(authorizer.TokenSource{AuthBearer: true}),
+	}, opts...)...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	sign, err := verifier.Sign(benchClaims())
+	if err != nil {
+		b.Fatal(err)
+	}
+	return verifier, sign
+}
+
+// benchClaims ...
+func benchClaims() *authorizer.AuthClaims {
+	return &authorizer.AuthClaims{
+		Details: &authorizer.Details{Roles: []string{"admin"}},
+	}
+}
+
+// benchUnSign ...
+func benchUnSign(b *testing.B, verifier *authorizer.VerifierService, sign string) {
+	req := httptest.NewRequest(http.MethodGet, "/get", nil)
+	req.Header.Set("Authorization", "Bearer "+sign)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := verifier.UnSign(req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSign(b *testing.B) {
+	for _, bk := range benchKeys {
+		b.Run(bk.name, func(b *testing.B) {
+			verifier, _ := benchVerifier(b, bk.keys)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := verifier.Sign(benchClaims()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUnSign(b *testing.B) {
+	for _, bk := range benchKeys {
+		b.Run(bk.name, func(b *testing.B) {
+			verifier, sign := benchVerifier(b, bk.keys)
+			benchUnSign(b, verifier, sign)
+		})
+	}
+}
+
+func BenchmarkUnSignCached(b *testing.B) {
+	verifier, sign := benchVerifier(b, benchKeys[0].keys, authorizer.WithCache(1024, time.Minute))
+	benchUnSign(b, verifier, sign)
+}
+
+func BenchmarkUnSignCachedParallel(b *testing.B) {
+	verifier, sign := benchVerifier(b, benchKeys[0].keys, authorizer.WithCache(1024, time.Minute))
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := verifier.Verify(sign); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkVerifyBatch(b *testing.B) {
+	for _, bk := range benchKeys {
+		for _, size := range []int{16, 256} {
+			b.Run(fmt.Sprintf("%s/%d", bk.name, size), func(b *testing.B) {
+				verifier, _ := benchVerifier(b, bk.keys)
+				tokens := make([]string, size)
+				for i := range tokens {
+					sign, err := verifier.Sign(benchClaims())
+					if err != nil {
+						b.Fatal(err)
+					}
+					tokens[i] = sign
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					for _, res := range verifier.VerifyBatch(tokens) {
+						if res.Err != nil {
+							b.Fatal(res.Err)
+						}
+					}
+				}
+			})
+		}
+	}
+}
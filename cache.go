@@ -0,0 +1,143 @@
+package authorizer
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// CacheStats ...
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Size      int    `json:"size"`
+}
+
+// tokenCache bounded lru of verified claims keyed by the token hash
+type tokenCache[T any] struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries *list.List
+	index   map[[sha256.Size]byte]*list.Element
+	stats   CacheStats
+}
+
+// cacheEntry ...
+type cacheEntry[T any] struct {
+	key     [sha256.Size]byte
+	claims  *Claims[T]
+	expires time.Time
+}
+
+// newTokenCache ...
+func newTokenCache[T any](size int, ttl time.Duration) *tokenCache[T] {
+	return &tokenCache[T]{
+		size:    size,
+		ttl:     ttl,
+		entries: list.New(),
+		index:   make(map[[sha256.Size]byte]*list.Element, size),
+	}
+}
+
+// get a copy of the cached claims, expired entries are dropped
+func (c *tokenCache[T]) get(token string) (*Claims[T], bool) {
+	key := sha256.Sum256([]byte(token))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.index[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry[T])
+	if !time.Now().Before(entry.expires) {
+		c.remove(elem)
+		c.stats.Misses++
+		return nil, false
+	}
+	claims, err := entry.claims.clone()
+	if err != nil {
+		c.remove(elem)
+		c.stats.Misses++
+		return nil, false
+	}
+	c.entries.MoveToFront(elem)
+	c.stats.Hits++
+	return claims, true
+}
+
+// add a verified token, kept until its exp or the ttl whichever comes first
+func (c *tokenCache[T]) add(token string, claims *Claims[T]) {
+	// never cache a token without any expiry
+	if c.ttl <= 0 && claims.ExpiresAt == 0 {
+		return
+	}
+	expires := time.Unix(claims.ExpiresAt, 0)
+	if ttl := time.Now().Add(c.ttl); c.ttl > 0 && (claims.ExpiresAt == 0 || ttl.Before(expires)) {
+		expires = ttl
+	}
+
+	// a MetaInfo that can't be copied is never cached
+	cached, err := claims.clone()
+	if err != nil {
+		return
+	}
+	key := sha256.Sum256([]byte(token))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.index[key]; ok {
+		c.remove(elem)
+	}
+	c.index[key] = c.entries.PushFront(&cacheEntry[T]{
+		key:     key,
+		claims:  cached,
+		expires: expires,
+	})
+	for c.entries.Len() > c.size {
+		c.remove(c.entries.Back())
+		c.stats.Evictions++
+	}
+}
+
+// remove ...
+func (c *tokenCache[T]) remove(elem *list.Element) {
+	c.entries.Remove(elem)
+	delete(c.index, elem.Value.(*cacheEntry[T]).key)
+}
+
+// snapshot ...
+func (c *tokenCache[T]) snapshot() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Size = c.entries.Len()
+	return stats
+}
+
+// clone deep copy of the claims, the MetaInfo is copied through json as it was decoded from it
+func (s *Claims[T]) clone() (*Claims[T], error) {
+	claims := *s
+	if s.Details != nil {
+		details := *s.Details
+		details.Roles = append([]string(nil), s.Details.Roles...)
+		claims.Details = &details
+	}
+	raw, err := json.Marshal(s.MetaInfo)
+	if err != nil {
+		return nil, err
+	}
+	var meta T
+	if err = json.Unmarshal(raw, &meta); err != nil {
+		return nil, err
+	}
+	claims.MetaInfo = meta
+	return &claims, nil
+}
@@ -0,0 +1,150 @@
+package authorizer_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+)
+
+var _ = Describe("Cache", func() {
+
+	var (
+		privKeyStr string
+		pubKeyStr  string
+	)
+
+	BeforeEach(func() {
+		privKeyStr, pubKeyStr = newKeyPair(2048)
+	})
+
+	Context("Hits and misses", func() {
+		It("Prepare", func() {
+
+			verifier, err := authorizer.New(
+				authorizer.WithKeys(privKeyStr, pubKeyStr),
+				authorizer.WithTokenSource(authorizer.TokenSource{AuthBearer: true}),
+				authorizer.WithCache(2, time.Minute),
+			)
+			Expect(err).To(BeNil())
+
+			tokens := make([]string, 3)
+			for i := range tokens {
+				tokens[i], err = verifier.Sign(&authorizer.AuthClaims{
+					MetaInfo: map[string]interface{}{"tenant": "acme", "groups": []interface{}{"ops"}},
+					Details:  &authorizer.Details{Roles: []string{"admin"}},
+				})
+				Expect(err).To(BeNil())
+			}
+
+			// miss then hit
+			res, err := verifier.Verify(tokens[0])
+			Expect(err).To(BeNil())
+			res.Details.Roles[0] = "changed"
+			meta := res.MetaInfo.(map[string]interface{})
+			meta["tenant"] = "changed"
+			meta["groups"].([]interface{})[0] = "changed"
+			res, err = verifier.Verify(tokens[0])
+			Expect(err).To(BeNil())
+			Expect(res.Details.Roles).To(Equal([]string{"admin"}))
+			Expect(res.MetaInfo).To(Equal(map[string]interface{}{"tenant": "acme", "groups": []interface{}{"ops"}}))
+			Expect(verifier.CacheStats()).To(Equal(authorizer.CacheStats{Hits: 1, Misses: 1, Size: 1}))
+
+			// bounded
+			_, err = verifier.Verify(tokens[1])
+			Expect(err).To(BeNil())
+			_, err = verifier.Verify(tokens[2])
+			Expect(err).To(BeNil())
+			stats := verifier.CacheStats()
+			Expect(stats.Size).To(Equal(2))
+			Expect(stats.Evictions).To(BeNumerically("==", 1))
+
+			// bad tokens are never cached
+			_, err = verifier.Verify(tokens[2] + "x")
+			Expect(err).NotTo(BeNil())
+			Expect(verifier.CacheStats().Size).To(Equal(2))
+
+			By("Hits and misses ok")
+		})
+	})
+
+	Context("Entries expire with the token", func() {
+		It("Prepare", func() {
+
+			verifier, err := authorizer.New(
+				authorizer.WithKeys(privKeyStr, pubKeyStr),
+				authorizer.WithTokenSource(authorizer.TokenSource{AuthBearer: true}),
+				authorizer.WithCache(10, time.Hour),
+			)
+			Expect(err).To(BeNil())
+
+			sign, err := verifier.Sign(&authorizer.AuthClaims{}, authorizer.SignOptions{TTL: time.Second})
+			Expect(err).To(BeNil())
+			_, err = verifier.Verify(sign)
+			Expect(err).To(BeNil())
+
+			Eventually(func() error {
+				_, err := verifier.Verify(sign)
+				return err
+			}).WithTimeout(5 * time.Second).WithPolling(200 * time.Millisecond).ShouldNot(Succeed())
+
+			By("Entries expire with the token ok")
+		})
+	})
+
+	Context("Revocation is checked on cache hits", func() {
+		It("Prepare", func() {
+
+			revoked := authorizer.NewRevocationList()
+			verifier, err := authorizer.New(
+				authorizer.WithKeys(privKeyStr, pubKeyStr),
+				authorizer.WithTokenSource(authorizer.TokenSource{AuthBearer: true}),
+				authorizer.WithCache(10, time.Minute),
+				authorizer.WithRevocation(revoked),
+			)
+			Expect(err).To(BeNil())
+
+			sign, err := verifier.Sign(&authorizer.AuthClaims{
+				StandardClaims: jwt.StandardClaims{Id: "ci-jti-revoke"},
+			})
+			Expect(err).To(BeNil())
+			_, err = verifier.Verify(sign)
+			Expect(err).To(BeNil())
+
+			revoked.Revoke("ci-jti-revoke", time.Time{})
+			_, err = verifier.Verify(sign)
+			Expect(errors.Is(err, authorizer.ErrRevokedToken)).To(BeTrue())
+			Expect(verifier.CacheStats().Hits).To(BeNumerically("==", 1))
+
+			By("Revocation is checked on cache hits ok")
+		})
+	})
+
+	Context("Expired revocations are purged", func() {
+		It("Prepare", func() {
+
+			revoked := authorizer.NewRevocationList()
+			revoked.Revoke("ci-jti-short", time.Now().Add(50*time.Millisecond))
+			revoked.Revoke("ci-jti-again", time.Now().Add(50*time.Millisecond))
+			revoked.Revoke("ci-jti-again", time.Now().Add(time.Hour))
+			revoked.Revoke("ci-jti-forever", time.Time{})
+			Expect(revoked.Len()).To(Equal(3))
+
+			time.Sleep(100 * time.Millisecond)
+			ok, err := revoked.IsRevoked(&jwt.StandardClaims{Id: "ci-jti-short"})
+			Expect(err).To(BeNil())
+			Expect(ok).To(BeFalse())
+			ok, err = revoked.IsRevoked(&jwt.StandardClaims{Id: "ci-jti-again"})
+			Expect(err).To(BeNil())
+			Expect(ok).To(BeTrue())
+			Expect(revoked.Len()).To(Equal(2))
+
+			By("Expired revocations are purged ok")
+		})
+	})
+})
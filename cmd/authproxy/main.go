@@ -0,0 +1,115 @@
+// Command authproxy reverse proxy that verifies the token of every request before
+// forwarding it to the upstream, or the forward-auth endpoint of an ingress
+// ( nginx auth_request, Traefik ForwardAuth ).
+//
+//	authproxy -config /etc/authproxy/config.yaml
+//	authproxy -config /etc/authproxy/config.yaml -mode forward-auth
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bayugyug/authorizer"
+)
+
+const (
+	defaultListen = ":8080"
+
+	modeProxy       = "proxy"
+	modeForwardAuth = "forward-auth"
+)
+
+func main() {
+	configPath := flag.String("config", "authproxy.yaml", "json/yaml config file")
+	envPrefix := flag.String("env-prefix", "AUTHPROXY", "prefix of the environment variables overriding the verifier config")
+	mode := flag.String("mode", modeProxy, "proxy or forward-auth")
+	flag.Parse()
+
+	if err := run(*configPath, *envPrefix, *mode); err != nil {
+		log.Fatalln("authproxy:", err)
+	}
+}
+
+// run ...
+func run(configPath, envPrefix, mode string) error {
+	cfg, err := authorizer.LoadProxyConfig(configPath)
+	if err != nil {
+		return err
+	}
+	fromEnv, err := authorizer.ConfigFromEnv(envPrefix)
+	if err != nil {
+		return err
+	}
+	cfg.Verifier.Merge(fromEnv)
+
+	opts, err := cfg.Verifier.Options()
+	if err != nil {
+		return err
+	}
+	verifier, err := authorizer.New(authorizer.WithOptions(opts))
+	if err != nil {
+		return err
+	}
+	handler, err := newHandler(mode, verifier, cfg)
+	if err != nil {
+		return err
+	}
+
+	listen := cfg.Listen
+	if listen == "" {
+		listen = defaultListen
+	}
+	return serve(listen, handler)
+}
+
+// newHandler ...
+func newHandler(mode string, verifier authorizer.VerifierServiceCreator, cfg *authorizer.ProxyConfig) (http.Handler, error) {
+	switch mode {
+	case modeProxy:
+		return authorizer.NewTokenProxy(verifier, cfg)
+	case modeForwardAuth:
+		return authorizer.NewForwardAuth(verifier, cfg)
+	default:
+		return nil, fmt.Errorf("unknown mode %q", mode)
+	}
+}
+
+// serve until SIGINT/SIGTERM
+func serve(listen string, handler http.Handler) error {
+	srv := &http.Server{
+		Addr:              listen,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		log.Println("authproxy: listening on", listen)
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdown); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
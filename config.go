@@ -0,0 +1,352 @@
+package authorizer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config file/envt form of the Options
+//
+// Precedence ( lowest to highest ):
+//   - defaults of the service
+//   - the config file ( LoadConfigFile )
+//   - the environment variables ( ConfigFromEnv )
+//   - functional options passed to New after WithOptions
+//
+// A key is given inline ( real or escaped new lines ), as "base64:<encoded pem>",
+// as "file:<path>" or via the *_file entry which is only used when the inline one is empty.
+type Config struct {
+	PrivateKey     string            `json:"private_key,omitempty" yaml:"private_key,omitempty"`
+	PrivateKeyFile string            `json:"private_key_file,omitempty" yaml:"private_key_file,omitempty"`
+	PublicKey      string            `json:"public_key,omitempty" yaml:"public_key,omitempty"`
+	PublicKeyFile  string            `json:"public_key_file,omitempty" yaml:"public_key_file,omitempty"`
+	Issuer         string            `json:"issuer,omitempty" yaml:"issuer,omitempty"`
+	Audience       string            `json:"audience,omitempty" yaml:"audience,omitempty"`
+	Expiry         string            `json:"expiry,omitempty" yaml:"expiry,omitempty"` // duration ie: 48h
+	SaltSubject    *bool             `json:"salt_subject,omitempty" yaml:"salt_subject,omitempty"`
+	TokenSource    ConfigTokenSource `json:"token_source,omitempty" yaml:"token_source,omitempty"`
+	CacheSize      int               `json:"cache_size,omitempty" yaml:"cache_size,omitempty"`
+	CacheTTL       string            `json:"cache_ttl,omitempty" yaml:"cache_ttl,omitempty"` // duration ie: 5m
+
+	EncryptionKey     string `json:"encryption_key,omitempty" yaml:"encryption_key,omitempty"`
+	EncryptionKeyFile string `json:"encryption_key_file,omitempty" yaml:"encryption_key_file,omitempty"`
+	DecryptionKey     string `json:"decryption_key,omitempty" yaml:"decryption_key,omitempty"`
+	DecryptionKeyFile string `json:"decryption_key_file,omitempty" yaml:"decryption_key_file,omitempty"`
+
+	FieldKey      string   `json:"field_key,omitempty" yaml:"field_key,omitempty"` // the base64 AES key, inline, base64:<key> or in file:<path>
+	EncryptFields []string `json:"encrypt_fields,omitempty" yaml:"encrypt_fields,omitempty"`
+
+	Algorithms       []string `json:"algorithms,omitempty" yaml:"algorithms,omitempty"`
+	MinRSABits       int      `json:"min_rsa_bits,omitempty" yaml:"min_rsa_bits,omitempty"`
+	ECCurves         []string `json:"ec_curves,omitempty" yaml:"ec_curves,omitempty"`
+	RejectKeyHeaders *bool    `json:"reject_key_headers,omitempty" yaml:"reject_key_headers,omitempty"`
+}
+
+// ConfigTokenSource ...
+type ConfigTokenSource struct {
+	HeaderKey  string `json:"header_key,omitempty" yaml:"header_key,omitempty"`
+	QueryKey   string `json:"query_key,omitempty" yaml:"query_key,omitempty"`
+	AuthBearer *bool  `json:"auth_bearer,omitempty" yaml:"auth_bearer,omitempty"`
+}
+
+const (
+	keyPrefixFile   = "file:"
+	keyPrefixBase64 = "base64:"
+)
+
+// LoadConfigFile read a json ( .json ) or yaml ( any other extension ) config file
+func LoadConfigFile(path string) (*Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	format := "yaml"
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		format = "json"
+	}
+	return ParseConfig(raw, format)
+}
+
+// ParseConfig decode a json or yaml document
+func ParseConfig(raw []byte, format string) (*Config, error) {
+	cfg := &Config{}
+	var err error
+	switch strings.ToLower(format) {
+	case "json":
+		err = json.Unmarshal(raw, cfg)
+	case "yaml", "yml":
+		err = yaml.Unmarshal(raw, cfg)
+	default:
+		err = fmt.Errorf("unsupported config format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ConfigFromEnv read the <prefix>_* environment variables
+//
+//	<prefix>_PRIVATE_KEY, <prefix>_PRIVATE_KEY_FILE, <prefix>_PUBLIC_KEY, <prefix>_PUBLIC_KEY_FILE,
+//	<prefix>_ISSUER, <prefix>_AUDIENCE, <prefix>_EXPIRY, <prefix>_SALT_SUBJECT,
+//	<prefix>_HEADER_KEY, <prefix>_QUERY_KEY, <prefix>_AUTH_BEARER, <prefix>_CACHE_SIZE, <prefix>_CACHE_TTL,
+//	<prefix>_ENCRYPTION_KEY, <prefix>_ENCRYPTION_KEY_FILE, <prefix>_DECRYPTION_KEY, <prefix>_DECRYPTION_KEY_FILE,
+//	<prefix>_FIELD_KEY, <prefix>_ENCRYPT_FIELDS ( comma separated ),
+//	<prefix>_ALGORITHMS, <prefix>_EC_CURVES ( comma separated ), <prefix>_MIN_RSA_BITS, <prefix>_REJECT_KEY_HEADERS
+func ConfigFromEnv(prefix string) (*Config, error) {
+	env := func(name string) string {
+		return strings.TrimSpace(os.Getenv(strings.ToUpper(prefix + "_" + name)))
+	}
+	cfg := &Config{
+		PrivateKey:        env("PRIVATE_KEY"),
+		PrivateKeyFile:    env("PRIVATE_KEY_FILE"),
+		PublicKey:         env("PUBLIC_KEY"),
+		PublicKeyFile:     env("PUBLIC_KEY_FILE"),
+		Issuer:            env("ISSUER"),
+		Audience:          env("AUDIENCE"),
+		Expiry:            env("EXPIRY"),
+		CacheTTL:          env("CACHE_TTL"),
+		EncryptionKey:     env("ENCRYPTION_KEY"),
+		EncryptionKeyFile: env("ENCRYPTION_KEY_FILE"),
+		DecryptionKey:     env("DECRYPTION_KEY"),
+		DecryptionKeyFile: env("DECRYPTION_KEY_FILE"),
+		FieldKey:          env("FIELD_KEY"),
+		TokenSource: ConfigTokenSource{
+			HeaderKey: env("HEADER_KEY"),
+			QueryKey:  env("QUERY_KEY"),
+		},
+	}
+	var err error
+	if cfg.SaltSubject, err = envBool(env("SALT_SUBJECT")); err != nil {
+		return nil, fmt.Errorf("%s_SALT_SUBJECT: %w", prefix, err)
+	}
+	if cfg.TokenSource.AuthBearer, err = envBool(env("AUTH_BEARER")); err != nil {
+		return nil, fmt.Errorf("%s_AUTH_BEARER: %w", prefix, err)
+	}
+	if cfg.RejectKeyHeaders, err = envBool(env("REJECT_KEY_HEADERS")); err != nil {
+		return nil, fmt.Errorf("%s_REJECT_KEY_HEADERS: %w", prefix, err)
+	}
+	cfg.EncryptFields = envList(env("ENCRYPT_FIELDS"))
+	cfg.Algorithms = envList(env("ALGORITHMS"))
+	cfg.ECCurves = envList(env("EC_CURVES"))
+	if bits := env("MIN_RSA_BITS"); bits != "" {
+		if cfg.MinRSABits, err = strconv.Atoi(bits); err != nil {
+			return nil, fmt.Errorf("%s_MIN_RSA_BITS: %w", prefix, err)
+		}
+	}
+	if size := env("CACHE_SIZE"); size != "" {
+		if cfg.CacheSize, err = strconv.Atoi(size); err != nil {
+			return nil, fmt.Errorf("%s_CACHE_SIZE: %w", prefix, err)
+		}
+	}
+	return cfg, nil
+}
+
+// Merge the non empty values of other take over
+func (c *Config) Merge(other *Config) *Config {
+	if other == nil {
+		return c
+	}
+	// a key given on the higher level replaces both forms of the lower one
+	if other.PrivateKey != "" || other.PrivateKeyFile != "" {
+		c.PrivateKey, c.PrivateKeyFile = other.PrivateKey, other.PrivateKeyFile
+	}
+	if other.PublicKey != "" || other.PublicKeyFile != "" {
+		c.PublicKey, c.PublicKeyFile = other.PublicKey, other.PublicKeyFile
+	}
+	if other.EncryptionKey != "" || other.EncryptionKeyFile != "" {
+		c.EncryptionKey, c.EncryptionKeyFile = other.EncryptionKey, other.EncryptionKeyFile
+	}
+	if other.DecryptionKey != "" || other.DecryptionKeyFile != "" {
+		c.DecryptionKey, c.DecryptionKeyFile = other.DecryptionKey, other.DecryptionKeyFile
+	}
+	mergeString(&c.FieldKey, other.FieldKey)
+	if len(other.EncryptFields) > 0 {
+		c.EncryptFields = other.EncryptFields
+	}
+	if len(other.Algorithms) > 0 {
+		c.Algorithms = other.Algorithms
+	}
+	if len(other.ECCurves) > 0 {
+		c.ECCurves = other.ECCurves
+	}
+	if other.MinRSABits != 0 {
+		c.MinRSABits = other.MinRSABits
+	}
+	if other.RejectKeyHeaders != nil {
+		c.RejectKeyHeaders = other.RejectKeyHeaders
+	}
+	mergeString(&c.Issuer, other.Issuer)
+	mergeString(&c.Audience, other.Audience)
+	mergeString(&c.Expiry, other.Expiry)
+	mergeString(&c.TokenSource.HeaderKey, other.TokenSource.HeaderKey)
+	mergeString(&c.TokenSource.QueryKey, other.TokenSource.QueryKey)
+	mergeString(&c.CacheTTL, other.CacheTTL)
+	if other.CacheSize != 0 {
+		c.CacheSize = other.CacheSize
+	}
+	if other.SaltSubject != nil {
+		c.SaltSubject = other.SaltSubject
+	}
+	if other.TokenSource.AuthBearer != nil {
+		c.TokenSource.AuthBearer = other.TokenSource.AuthBearer
+	}
+	return c
+}
+
+// Options resolve the keys and build the service options
+func (c *Config) Options() (*Options, error) {
+	privateKey, err := resolveKey(c.PrivateKey, c.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("private key: %w", err)
+	}
+	publicKey, err := resolveKey(c.PublicKey, c.PublicKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("public key: %w", err)
+	}
+	encryptionKey, err := resolveKey(c.EncryptionKey, c.EncryptionKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key: %w", err)
+	}
+	decryptionKey, err := resolveKey(c.DecryptionKey, c.DecryptionKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("decryption key: %w", err)
+	}
+	fieldKey, err := resolveFieldKey(c.FieldKey)
+	if err != nil {
+		return nil, fmt.Errorf("field key: %w", err)
+	}
+	opts := &Options{
+		FieldKey:      fieldKey,
+		EncryptFields: c.EncryptFields,
+		Algorithms:    c.Algorithms,
+		MinRSABits:    c.MinRSABits,
+		ECCurves:      c.ECCurves,
+		PrivateKey:    privateKey,
+		PublicKey:     publicKey,
+		EncryptionKey: encryptionKey,
+		DecryptionKey: decryptionKey,
+		Issuer:        c.Issuer,
+		Audience:      c.Audience,
+		CacheSize:     c.CacheSize,
+		TokenSource: TokenSource{
+			HeaderKey: c.TokenSource.HeaderKey,
+			QueryKey:  c.TokenSource.QueryKey,
+		},
+	}
+	if c.Expiry != "" {
+		if opts.ExpiresIn, err = time.ParseDuration(c.Expiry); err != nil {
+			return nil, fmt.Errorf("expiry: %w", err)
+		}
+	}
+	if c.CacheTTL != "" {
+		if opts.CacheTTL, err = time.ParseDuration(c.CacheTTL); err != nil {
+			return nil, fmt.Errorf("cache ttl: %w", err)
+		}
+	}
+	if c.SaltSubject != nil {
+		opts.SaltSubject = *c.SaltSubject
+	}
+	if c.TokenSource.AuthBearer != nil {
+		opts.TokenSource.AuthBearer = *c.TokenSource.AuthBearer
+	}
+	if c.RejectKeyHeaders != nil {
+		opts.RejectKeyHeaders = *c.RejectKeyHeaders
+	}
+	return opts, nil
+}
+
+// LoadOptions the config file ( optional when path is empty ) overridden by the <envPrefix>_* variables
+func LoadOptions(path, envPrefix string) (*Options, error) {
+	cfg := &Config{}
+	if path != "" {
+		fromFile, err := LoadConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Merge(fromFile)
+	}
+	if envPrefix != "" {
+		fromEnv, err := ConfigFromEnv(envPrefix)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Merge(fromEnv)
+	}
+	return cfg.Options()
+}
+
+// resolveKey inline, base64: or file: value, else the content of the file entry
+func resolveKey(value, file string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, keyPrefixFile):
+		return readKeyFile(strings.TrimPrefix(value, keyPrefixFile))
+	case strings.HasPrefix(value, keyPrefixBase64):
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, keyPrefixBase64))
+		if err != nil {
+			return "", err
+		}
+		return string(raw), nil
+	case value != "":
+		return value, nil
+	case file != "":
+		return readKeyFile(file)
+	}
+	return "", nil
+}
+
+// resolveFieldKey the field key is base64 already, a base64: prefix is only dropped
+func resolveFieldKey(value string) (string, error) {
+	if strings.HasPrefix(value, keyPrefixBase64) {
+		return strings.TrimPrefix(value, keyPrefixBase64), nil
+	}
+	return resolveKey(value, "")
+}
+
+// readKeyFile ...
+func readKeyFile(path string) (string, error) {
+	raw, err := os.ReadFile(strings.TrimSpace(path))
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// mergeString ...
+func mergeString(dst *string, src string) {
+	if src != "" {
+		*dst = src
+	}
+}
+
+// envList the trimmed values of a comma separated list, nil when not set
+func envList(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		values = append(values, strings.TrimSpace(value))
+	}
+	return values
+}
+
+// envBool nil when not set
+func envBool(raw string) (*bool, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
@@ -0,0 +1,144 @@
+package authorizer_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+)
+
+var _ = Describe("Config", func() {
+
+	var (
+		dir        string
+		privKeyStr string
+		pubKeyStr  string
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		privKeyStr, pubKeyStr = newKeyPair(2048)
+	})
+
+	setenv := func(key, value string) {
+		Expect(os.Setenv(key, value)).To(Succeed())
+		DeferCleanup(os.Unsetenv, key)
+	}
+
+	Context("Load yaml with file and base64 keys", func() {
+		It("Prepare", func() {
+
+			privPath := filepath.Join(dir, "priv.pem")
+			Expect(os.WriteFile(privPath, []byte(privKeyStr), 0o600)).To(Succeed())
+
+			cfgPath := filepath.Join(dir, "verifier.yaml")
+			Expect(os.WriteFile(cfgPath, []byte(fmt.Sprintf(`
+private_key_file: %s
+public_key: base64:%s
+issuer: ci-yaml
+expiry: 90m
+token_source:
+  auth_bearer: true
+`, privPath, base64.StdEncoding.EncodeToString([]byte(pubKeyStr)))), 0o600)).To(Succeed())
+
+			opts, err := authorizer.LoadOptions(cfgPath, "")
+			Expect(err).To(BeNil())
+			Expect(opts.PrivateKey).To(Equal(privKeyStr))
+			Expect(opts.PublicKey).To(Equal(pubKeyStr))
+			Expect(opts.Issuer).To(Equal("ci-yaml"))
+			Expect(opts.ExpiresIn).To(Equal(90 * time.Minute))
+			Expect(opts.TokenSource.AuthBearer).To(BeTrue())
+
+			verifier, err := authorizer.New(authorizer.WithOptions(opts))
+			Expect(err).To(BeNil())
+			Expect(verifier).NotTo(BeNil())
+
+			By("Load yaml with file and base64 keys ok")
+		})
+	})
+
+	Context("Field key forms", func() {
+		It("Prepare", func() {
+
+			raw := make([]byte, 32)
+			for i := range raw {
+				raw[i] = byte(i)
+			}
+			fieldKey := base64.StdEncoding.EncodeToString(raw)
+			keyPath := filepath.Join(dir, "field.key")
+			Expect(os.WriteFile(keyPath, []byte(fieldKey+"\n"), 0o600)).To(Succeed())
+
+			for _, value := range []string{fieldKey, "base64:" + fieldKey, "file:" + keyPath} {
+				cfg, err := authorizer.ParseConfig([]byte(fmt.Sprintf("public_key: base64:%s\nfield_key: %q\n",
+					base64.StdEncoding.EncodeToString([]byte(pubKeyStr)), value)), "yaml")
+				Expect(err).To(BeNil(), value)
+				opts, err := cfg.Options()
+				Expect(err).To(BeNil(), value)
+				Expect(strings.TrimSpace(opts.FieldKey)).To(Equal(fieldKey), value)
+				_, err = authorizer.New(authorizer.WithOptions(opts), authorizer.WithTokenSource(authorizer.TokenSource{AuthBearer: true}))
+				Expect(err).To(BeNil(), value)
+			}
+
+			By("Field key forms ok")
+		})
+	})
+
+	Context("Environment overrides the json file", func() {
+		It("Prepare", func() {
+
+			cfgPath := filepath.Join(dir, "verifier.json")
+			Expect(os.WriteFile(cfgPath, []byte(`{
+				"public_key_file": "/does/not/exist.pem",
+				"issuer": "ci-json",
+				"audience": "ci-json-aud",
+				"token_source": {"auth_bearer": true, "query_key": "_verify"}
+			}`), 0o600)).To(Succeed())
+
+			// escaped new lines as they usually come from the envt
+			setenv("CIVERIFIER_PUBLIC_KEY", strings.ReplaceAll(pubKeyStr, "\n", "\\n"))
+			setenv("CIVERIFIER_ISSUER", "ci-env")
+			setenv("CIVERIFIER_AUTH_BEARER", "false")
+
+			opts, err := authorizer.LoadOptions(cfgPath, "CIVERIFIER")
+			Expect(err).To(BeNil())
+			Expect(opts.Issuer).To(Equal("ci-env"))
+			Expect(opts.Audience).To(Equal("ci-json-aud"))
+			Expect(opts.TokenSource.AuthBearer).To(BeFalse())
+			Expect(opts.TokenSource.QueryKey).To(Equal("_verify"))
+
+			_, err = authorizer.New(authorizer.WithOptions(opts))
+			Expect(err).To(BeNil())
+
+			By("Environment overrides the json file ok")
+		})
+	})
+
+	Context("Invalid config", func() {
+		It("Prepare", func() {
+
+			_, err := authorizer.ParseConfig([]byte(`expiry: [`), "yaml")
+			Expect(err).NotTo(BeNil())
+
+			_, err = authorizer.ParseConfig([]byte(`{}`), "toml")
+			Expect(err).NotTo(BeNil())
+
+			cfg, err := authorizer.ParseConfig([]byte(`{"expiry": "two days", "public_key": "file:/does/not/exist.pem"}`), "json")
+			Expect(err).To(BeNil())
+			_, err = cfg.Options()
+			Expect(err).NotTo(BeNil())
+
+			setenv("CIBROKEN_SALT_SUBJECT", "maybe")
+			_, err = authorizer.ConfigFromEnv("CIBROKEN")
+			Expect(err).NotTo(BeNil())
+
+			By("Invalid config ok")
+		})
+	})
+})
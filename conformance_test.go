@@ -0,0 +1,126 @@
+package authorizer_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+	"github.com/bayugyug/authorizer/authorizertest"
+)
+
+// conformanceCorpus testdata/conformance/jws.json
+type conformanceCorpus struct {
+	Keys    map[string]string `json:"keys"`
+	Vectors []struct {
+		Name   string `json:"name"`
+		Source string `json:"source"`
+		Key    string `json:"key"`
+		Token  string `json:"token"`
+		Expect string `json:"expect"`
+		// Verifies the signature alone, for the RFC examples whose payload is not a claims set
+		Verifies *bool `json:"verifies"`
+	} `json:"vectors"`
+}
+
+// loadConformance ...
+func loadConformance() *conformanceCorpus {
+	raw, err := os.ReadFile(filepath.Join("testdata", "conformance", "jws.json"))
+	if err != nil {
+		panic(err)
+	}
+	corpus := &conformanceCorpus{}
+	if err = json.Unmarshal(raw, corpus); err != nil {
+		panic(err)
+	}
+	return corpus
+}
+
+// conformanceOutcome map the verification error to the expected outcome of a vector
+func conformanceOutcome(err error) string {
+	if err == nil {
+		return "valid"
+	}
+	if errors.Is(err, authorizer.ErrEmptyToken) {
+		return "empty"
+	}
+	if errors.Is(err, authorizer.ErrTokenTooLarge) {
+		return "too_large"
+	}
+	var vErr *jwt.ValidationError
+	if !errors.As(err, &vErr) {
+		return "error"
+	}
+	switch {
+	case vErr.Errors&jwt.ValidationErrorMalformed != 0:
+		return "malformed"
+	case vErr.Errors&jwt.ValidationErrorUnverifiable != 0:
+		return "unverifiable"
+	case vErr.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+		return "signature"
+	case vErr.Errors&jwt.ValidationErrorExpired != 0:
+		return "expired"
+	case vErr.Errors&jwt.ValidationErrorNotValidYet != 0:
+		return "not_yet_valid"
+	}
+	return "error"
+}
+
+var _ = Describe("Conformance", func() {
+
+	corpus := loadConformance()
+
+	for _, vector := range corpus.Vectors {
+		vector := vector
+		It(vector.Name, func() {
+			Expect(corpus.Keys).To(HaveKey(vector.Key))
+			verifier := authorizer.NewTypedVerifierService[interface{}](&authorizer.Options{
+				PublicKey: corpus.Keys[vector.Key],
+			})
+			_, err := verifier.Verify(vector.Token)
+			Expect(conformanceOutcome(err)).To(Equal(vector.Expect), "%s: %v", vector.Source, err)
+
+			if vector.Verifies != nil {
+				key, err := authorizer.ParsePublicKey(corpus.Keys[vector.Key])
+				Expect(err).To(BeNil())
+				parts := strings.Split(vector.Token, ".")
+				Expect(parts).To(HaveLen(3))
+				// the payload is not a claims set, only the header is decoded
+				raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+				Expect(err).To(BeNil())
+				var header struct {
+					Alg string `json:"alg"`
+				}
+				Expect(json.Unmarshal(raw, &header)).To(Succeed())
+				method := jwt.GetSigningMethod(header.Alg)
+				Expect(method).NotTo(BeNil())
+				err = method.Verify(parts[0]+"."+parts[1], parts[2], key)
+				Expect(err == nil).To(Equal(*vector.Verifies), "%s: %v", vector.Source, err)
+			}
+		})
+	}
+
+	It("token size limit", func() {
+		verifier := authorizertest.NewVerifier(GinkgoT(), authorizer.WithMaxTokenBytes(512))
+		tokens := authorizertest.NewTokenFactory(GinkgoT(), verifier)
+		token := tokens.Valid()
+		Expect(len(token)).To(BeNumerically(">", 512))
+		_, err := verifier.Verify(token)
+		Expect(err).To(MatchError(authorizer.ErrTokenTooLarge))
+
+		// no limit when negative
+		verifier = authorizertest.NewVerifier(GinkgoT(), authorizer.WithMaxTokenBytes(-1))
+		_, err = verifier.Verify(authorizertest.NewTokenFactory(GinkgoT(), verifier).Valid(
+			authorizertest.WithMetaInfo(map[string]interface{}{"blob": strings.Repeat("A", 2*authorizer.DefaultMaxTokenBytes)}),
+		))
+		Expect(err).To(BeNil())
+	})
+})
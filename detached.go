@@ -0,0 +1,190 @@
+package authorizer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// DefaultBodySignatureHeader header of the detached JWS of a request body
+	DefaultBodySignatureHeader = "X-JWS-Signature"
+	// DefaultMaxBodyBytes largest body read by the body signature middleware
+	DefaultMaxBodyBytes = 10 << 20
+	// detachedType typ header of the detached signatures, they are never accepted as access tokens
+	detachedType = "detached+jws"
+)
+
+var (
+	// ErrInvalidDetachedJWS ...
+	ErrInvalidDetachedJWS = errors.New("invalid detached jws")
+	// ErrDetachedJWS ...
+	ErrDetachedJWS = errors.New("detached signature is not an access token")
+)
+
+// BytesOptions of SignBytes
+type BytesOptions struct {
+	// Encoded base64url payload in the signing input ( RFC 7515 appendix F ),
+	// by default the payload is signed as is ( RFC 7797 b64=false )
+	Encoded bool
+	// KeyID kid header
+	KeyID string
+}
+
+// detachedHeader ...
+type detachedHeader struct {
+	Alg  string   `json:"alg"`
+	Typ  string   `json:"typ"`
+	Kid  string   `json:"kid,omitempty"`
+	B64  *bool    `json:"b64,omitempty"`
+	Crit []string `json:"crit,omitempty"`
+}
+
+// SignBytes detached compact JWS of the payload: <header>..<signature>
+func (s *TypedVerifierService[T]) SignBytes(payload []byte, opts ...BytesOptions) (string, error) {
+	if s.privateErr != nil {
+		return "", s.privateErr
+	}
+	var o BytesOptions
+	for _, opt := range opts {
+		o.Encoded = o.Encoded || opt.Encoded
+		if opt.KeyID != "" {
+			o.KeyID = opt.KeyID
+		}
+	}
+
+	header := detachedHeader{Alg: s.method.Alg(), Typ: detachedType, Kid: o.KeyID}
+	if !o.Encoded {
+		b64 := false
+		header.B64 = &b64
+		header.Crit = []string{"b64"}
+	}
+	raw, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	encodedHeader := base64.RawURLEncoding.EncodeToString(raw)
+
+	sig, err := s.method.Sign(signingInput(encodedHeader, payload, o.Encoded), s.privateKey)
+	if err != nil {
+		return "", err
+	}
+	return encodedHeader + ".." + sig, nil
+}
+
+// VerifyBytes check a detached JWS made by SignBytes against the payload
+func (s *TypedVerifierService[T]) VerifyBytes(jws string, payload []byte) error {
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 || parts[1] != "" {
+		return ErrInvalidDetachedJWS
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDetachedJWS, err)
+	}
+	var header detachedHeader
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDetachedJWS, err)
+	}
+	// the whole protected header, for the key header policy
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDetachedJWS, err)
+	}
+
+	// only the signatures of SignBytes, never a token of the same key
+	if header.Typ != detachedType {
+		return fmt.Errorf("%w: typ %q", ErrInvalidDetachedJWS, header.Typ)
+	}
+
+	// b64=false must be understood, nothing else is
+	encoded := header.B64 == nil || *header.B64
+	for _, name := range header.Crit {
+		if name != "b64" {
+			return fmt.Errorf("%w: unsupported crit %s", ErrInvalidDetachedJWS, name)
+		}
+	}
+	if !encoded && len(header.Crit) == 0 {
+		return fmt.Errorf("%w: b64 must be critical", ErrInvalidDetachedJWS)
+	}
+
+	method := jwt.GetSigningMethod(header.Alg)
+	if method == nil {
+		return fmt.Errorf("%w: unsupported alg %s", ErrInvalidDetachedJWS, header.Alg)
+	}
+	key, err := s.verificationKey(&jwt.Token{Method: method, Header: fields})
+	if err != nil {
+		return err
+	}
+	if err := method.Verify(signingInput(parts[0], payload, encoded), parts[2], key); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDetachedJWS, err)
+	}
+	return nil
+}
+
+// SignRequestBody put the detached JWS of the body in the header ( DefaultBodySignatureHeader when empty ),
+// ie: for outgoing webhooks, the body is restored
+func (s *TypedVerifierService[T]) SignRequestBody(r *http.Request, header string) error {
+	if header == "" {
+		header = DefaultBodySignatureHeader
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	jws, err := s.SignBytes(body)
+	if err != nil {
+		return err
+	}
+	r.Header.Set(header, jws)
+	return nil
+}
+
+// BodySignatureMiddleware chi compatible, verify the detached JWS of the header ( DefaultBodySignatureHeader
+// when empty ) against the raw body, the downstream handler reads the body as usual.
+// 401 on a missing/invalid signature, 413 over DefaultMaxBodyBytes.
+func (s *TypedVerifierService[T]) BodySignatureMiddleware(header string) func(http.Handler) http.Handler {
+	if header == "" {
+		header = DefaultBodySignatureHeader
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			jws := r.Header.Get(header)
+			if jws == "" {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, DefaultMaxBodyBytes)
+			}
+			body, err := readBody(r)
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			if err := s.VerifyBytes(jws, body); err != nil {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// signingInput <header>.<payload> with the payload as is or base64url encoded
+func signingInput(encodedHeader string, payload []byte, encoded bool) string {
+	if encoded {
+		return encodedHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	}
+	return encodedHeader + "." + string(payload)
+}
@@ -0,0 +1,150 @@
+package authorizer_test
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+	"github.com/bayugyug/authorizer/authorizertest"
+)
+
+var _ = Describe("DetachedJWS", func() {
+
+	var verifier *authorizer.VerifierService
+
+	BeforeEach(func() {
+		verifier = authorizertest.NewVerifier(GinkgoT())
+	})
+
+	Context("Unencoded and encoded payloads", func() {
+		It("Prepare", func() {
+
+			payload := []byte("id,amount\n1001,10.50\n1002,99.99\n")
+
+			jws, err := verifier.SignBytes(payload, authorizer.BytesOptions{KeyID: "export-2024"})
+			Expect(err).To(BeNil())
+			parts := strings.Split(jws, ".")
+			Expect(parts).To(HaveLen(3))
+			Expect(parts[1]).To(BeEmpty())
+			header, err := base64.RawURLEncoding.DecodeString(parts[0])
+			Expect(err).To(BeNil())
+			Expect(string(header)).To(Equal(`{"alg":"RS256","typ":"detached+jws","kid":"export-2024","b64":false,"crit":["b64"]}`))
+			Expect(verifier.VerifyBytes(jws, payload)).To(Succeed())
+			Expect(verifier.VerifyBytes(jws, append(payload, '\n'))).To(MatchError(authorizer.ErrInvalidDetachedJWS))
+
+			jws, err = verifier.SignBytes(payload, authorizer.BytesOptions{Encoded: true})
+			Expect(err).To(BeNil())
+			header, _ = base64.RawURLEncoding.DecodeString(strings.Split(jws, ".")[0])
+			Expect(string(header)).To(Equal(`{"alg":"RS256","typ":"detached+jws"}`))
+			Expect(verifier.VerifyBytes(jws, payload)).To(Succeed())
+
+			ecKeys := authorizertest.NewECKeyPair(GinkgoT(), elliptic.P384())
+			ecVerifier, err := authorizer.New(authorizer.WithKeys(ecKeys.PrivateKey, ecKeys.PublicKey), authorizer.WithTokenSource(authorizertest.DefaultTokenSource))
+			Expect(err).To(BeNil())
+			jws, err = ecVerifier.SignBytes(payload)
+			Expect(err).To(BeNil())
+			Expect(ecVerifier.VerifyBytes(jws, payload)).To(Succeed())
+			Expect(verifier.VerifyBytes(jws, payload)).NotTo(Succeed())
+
+			By("Unencoded and encoded payloads ok")
+		})
+	})
+
+	Context("Malformed headers", func() {
+		It("Prepare", func() {
+
+			payload := []byte(`{"event":"paid"}`)
+			jws, err := verifier.SignBytes(payload)
+			Expect(err).To(BeNil())
+			sig := strings.Split(jws, ".")[2]
+
+			encode := func(header string) string {
+				return base64.RawURLEncoding.EncodeToString([]byte(header)) + ".." + sig
+			}
+			for _, bad := range []string{
+				"",
+				"a.b.c",
+				strings.Replace(jws, "..", ".eyJ9.", 1),
+				encode(`{"alg":"RS256","b64":false,"crit":["b64"]}`),
+				encode(`{"alg":"RS256","typ":"detached+jws","b64":false}`),
+				encode(`{"alg":"RS256","b64":false,"crit":["b64","exp"]}`),
+				encode(`{"alg":"none","b64":false,"crit":["b64"]}`),
+				encode(`{"alg":"RS256","b64":false,"crit":["b64"],"kid":"x"}`),
+			} {
+				Expect(verifier.VerifyBytes(bad, payload)).NotTo(Succeed(), bad)
+			}
+
+			By("Malformed headers ok")
+		})
+	})
+
+	Context("Not an access token", func() {
+		It("Prepare", func() {
+
+			// the payload put back between the dots must not pass as a token of the same key
+			payload := []byte(`{"details":{"roles":["admin"]}}`)
+			jws, err := verifier.SignBytes(payload, authorizer.BytesOptions{Encoded: true})
+			Expect(err).To(BeNil())
+			parts := strings.Split(jws, ".")
+			token := parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+			_, err = verifier.Verify(token)
+			Expect(err).To(MatchError(authorizer.ErrDetachedJWS))
+			req := authorizertest.NewRequest("GET", "/", nil, authorizertest.DefaultTokenSource, token)
+			_, err = verifier.UnSign(req)
+			Expect(err).To(MatchError(authorizer.ErrDetachedJWS))
+
+			// nor a body that is base64url text itself
+			body := base64.RawURLEncoding.EncodeToString(payload)
+			jws, err = verifier.SignBytes([]byte(body))
+			Expect(err).To(BeNil())
+			parts = strings.Split(jws, ".")
+			_, err = verifier.Verify(parts[0] + "." + body + "." + parts[2])
+			Expect(err).NotTo(BeNil())
+
+			By("Not an access token ok")
+		})
+	})
+
+	Context("Webhook body middleware", func() {
+		It("Prepare", func() {
+
+			var seen []byte
+			handler := verifier.BodySignatureMiddleware("")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen, _ = io.ReadAll(r.Body)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			serve := func(req *http.Request) int {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				return w.Code
+			}
+
+			body := `{"event":"invoice.paid","id":"inv_1001"}`
+			req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body))
+			Expect(verifier.SignRequestBody(req, "")).To(Succeed())
+			Expect(req.Header.Get(authorizer.DefaultBodySignatureHeader)).NotTo(BeEmpty())
+			Expect(serve(req)).To(Equal(http.StatusNoContent))
+			Expect(string(seen)).To(Equal(body))
+
+			tampered := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(strings.Replace(body, "1001", "1002", 1)))
+			tampered.Header = req.Header.Clone()
+			Expect(serve(tampered)).To(Equal(http.StatusUnauthorized))
+
+			Expect(serve(httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body)))).To(Equal(http.StatusUnauthorized))
+
+			large := httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(make([]byte, authorizer.DefaultMaxBodyBytes+1)))
+			large.Header = req.Header.Clone()
+			Expect(serve(large)).To(Equal(http.StatusRequestEntityTooLarge))
+
+			By("Webhook body middleware ok")
+		})
+	})
+})
@@ -0,0 +1,433 @@
+package authorizer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/go-chi/chi"
+)
+
+var (
+	// ErrInvalidExpression ...
+	ErrInvalidExpression = errors.New("invalid expression")
+)
+
+// Expression compiled access expression over the claims and the request.
+//
+//	details.auth_type == 'sso'
+//	request.param.tenant in claims.meta_info.tenants && request.method != 'DELETE'
+//	'admin' in claims.roles || (claims.iss == 'https://issuer' && !(request.header.X-Readonly == 'true'))
+//
+// Operands:
+//   - claims.<name>: sub, iss, aud, jti, scope, uuid, name, auth_type, method, roles, meta_info.<key> ( see ClaimValues )
+//   - details.<name>: uuid, name, auth_type, method, roles
+//   - request.method, request.path, request.param.<chi url param>, request.header.<name>, request.query.<name>
+//   - 'string' or "string", numbers, [list, of, literals], true, false
+//
+// Every operand is a list of values, a missing claim is the empty list:
+//   - a == b at least one value in common, a != b none
+//   - a in b every value of a ( at least one ) is in b
+type Expression struct {
+	src  string
+	root boolNode
+}
+
+// CompileExpression parse and validate, unknown operands and non boolean expressions are rejected
+func CompileExpression(src string) (*Expression, error) {
+	tokens, err := lexExpression(src)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidExpression, src, err)
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokEOF {
+		err = fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidExpression, src, err)
+	}
+	return &Expression{src: src, root: root}, nil
+}
+
+// MustCompileExpression panics on an invalid expression, for package level rules
+func MustCompileExpression(src string) *Expression {
+	e, err := CompileExpression(src)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// String the source
+func (e *Expression) String() string {
+	return e.src
+}
+
+// Eval against the claims and the request ( nil for claims only expressions )
+func (e *Expression) Eval(claims *AuthClaims, r *http.Request) bool {
+	if claims == nil {
+		claims = &AuthClaims{}
+	}
+	return e.root.eval(&exprEnv{claims: claims, r: r})
+}
+
+// ExpressionMiddleware chi compatible, every expression must hold.
+// The claims come from the context ( ie: set by Policy.Middleware ) or else from UnSign,
+// 401 when the token does not verify, 403 when an expression is false.
+// Mount it with router.With / inside router.Route to have the url params of request.param.
+func ExpressionMiddleware(verifier VerifierServiceCreator, exprs ...*Expression) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				var err error
+				if claims, err = verifier.UnSign(r); err != nil {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+					return
+				}
+				r = r.WithContext(NewContext(r.Context(), claims))
+			}
+			for _, e := range exprs {
+				if !e.Eval(claims, r) {
+					http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// exprEnv ...
+type exprEnv struct {
+	claims *AuthClaims
+	r      *http.Request
+}
+
+// boolNode ...
+type boolNode interface {
+	eval(env *exprEnv) bool
+}
+
+// valueNode ...
+type valueNode interface {
+	values(env *exprEnv) []string
+}
+
+type (
+	andNode     struct{ left, right boolNode }
+	orNode      struct{ left, right boolNode }
+	notNode     struct{ operand boolNode }
+	constNode   bool
+	compareNode struct {
+		op          string
+		left, right valueNode
+	}
+	literalNode []string
+	operandNode func(env *exprEnv) []string
+)
+
+func (n andNode) eval(env *exprEnv) bool   { return n.left.eval(env) && n.right.eval(env) }
+func (n orNode) eval(env *exprEnv) bool    { return n.left.eval(env) || n.right.eval(env) }
+func (n notNode) eval(env *exprEnv) bool   { return !n.operand.eval(env) }
+func (n constNode) eval(env *exprEnv) bool { return bool(n) }
+
+func (n literalNode) values(env *exprEnv) []string { return n }
+func (n operandNode) values(env *exprEnv) []string { return n(env) }
+
+// eval ...
+func (n compareNode) eval(env *exprEnv) bool {
+	left, right := n.left.values(env), n.right.values(env)
+	switch n.op {
+	case "==":
+		return anyEqual(left, right)
+	case "!=":
+		return !anyEqual(left, right)
+	default: // in
+		if len(left) == 0 {
+			return false
+		}
+		for _, v := range left {
+			if !anyEqual([]string{v}, right) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// detailsOperands names allowed after details.
+var detailsOperands = map[string]bool{"uuid": true, "name": true, "auth_type": true, "method": true, "roles": true}
+
+// resolveOperand ...
+func resolveOperand(name string) (valueNode, error) {
+	namespace, field, _ := strings.Cut(name, ".")
+	switch namespace {
+	case "claims":
+		if !knownClaim(field) {
+			return nil, fmt.Errorf("unknown claim %q", field)
+		}
+		return operandNode(func(env *exprEnv) []string { return ClaimValues(env.claims, field) }), nil
+	case "details":
+		if !detailsOperands[field] {
+			return nil, fmt.Errorf("unknown details field %q", field)
+		}
+		return operandNode(func(env *exprEnv) []string { return ClaimValues(env.claims, field) }), nil
+	case "request":
+		return requestOperand(field)
+	}
+	return nil, fmt.Errorf("unknown operand %q", name)
+}
+
+// requestOperand ...
+func requestOperand(field string) (valueNode, error) {
+	switch field {
+	case "method":
+		return operandNode(func(env *exprEnv) []string {
+			if env.r == nil {
+				return nil
+			}
+			return nonEmpty(env.r.Method)
+		}), nil
+	case "path":
+		return operandNode(func(env *exprEnv) []string {
+			if env.r == nil {
+				return nil
+			}
+			return nonEmpty(env.r.URL.Path)
+		}), nil
+	}
+
+	kind, key, _ := strings.Cut(field, ".")
+	if key == "" {
+		return nil, fmt.Errorf("unknown request field %q", field)
+	}
+	switch kind {
+	case "param":
+		return operandNode(func(env *exprEnv) []string {
+			if env.r == nil {
+				return nil
+			}
+			return nonEmpty(chi.URLParam(env.r, key))
+		}), nil
+	case "header":
+		return operandNode(func(env *exprEnv) []string {
+			if env.r == nil {
+				return nil
+			}
+			return env.r.Header.Values(key)
+		}), nil
+	case "query":
+		return operandNode(func(env *exprEnv) []string {
+			if env.r == nil {
+				return nil
+			}
+			return env.r.URL.Query()[key]
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown request field %q", field)
+}
+
+// token kinds
+const (
+	tokEOF = iota
+	tokIdent
+	tokString
+	tokOp
+)
+
+// exprToken ...
+type exprToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+// lexExpression ...
+func lexExpression(src string) ([]exprToken, error) {
+	var tokens []exprToken
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'' || c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != c; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				b.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, exprToken{kind: tokString, text: b.String(), pos: i})
+			i = j + 1
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || strings.ContainsRune("_.-", runes[j])) {
+				j++
+			}
+			text := string(runes[i:j])
+			kind := tokIdent
+			if unicode.IsDigit(c) {
+				kind = tokString // numbers compare as their text
+			}
+			tokens = append(tokens, exprToken{kind: kind, text: text, pos: i})
+			i = j
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "&&", "||", "!", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(string(runes[i:]), candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, exprToken{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, exprToken{kind: tokEOF, pos: len(runes)}), nil
+}
+
+// exprParser recursive descent: or > and > not > comparison
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken { return p.tokens[p.pos] }
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept the operator if next
+func (p *exprParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// parseOr ...
+func (p *exprParser) parseOr() (boolNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseAnd ...
+func (p *exprParser) parseAnd() (boolNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseNot ...
+func (p *exprParser) parseNot() (boolNode, error) {
+	if p.accept("!") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison ( expr ), true, false or operand op operand
+func (p *exprParser) parseComparison() (boolNode, error) {
+	if p.accept("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing ) at %d", p.peek().pos)
+		}
+		return inner, nil
+	}
+	if t := p.peek(); t.kind == tokIdent && (t.text == "true" || t.text == "false") {
+		p.next()
+		return constNode(t.text == "true"), nil
+	}
+
+	left, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	t := p.next()
+	op := t.text
+	switch {
+	case t.kind == tokOp && (op == "==" || op == "!="):
+	case t.kind == tokIdent && op == "in":
+	default:
+		return nil, fmt.Errorf("expected ==, != or in at %d", t.pos)
+	}
+	right, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return compareNode{op: op, left: left, right: right}, nil
+}
+
+// parseValue literal, list of literals or operand
+func (p *exprParser) parseValue() (valueNode, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokString:
+		return literalNode{t.text}, nil
+	case t.kind == tokIdent && strings.Contains(t.text, "."):
+		return resolveOperand(t.text)
+	case t.kind == tokOp && t.text == "[":
+		list := literalNode{}
+		for !p.accept("]") {
+			if len(list) > 0 && !p.accept(",") {
+				return nil, fmt.Errorf("expected , at %d", p.peek().pos)
+			}
+			item := p.next()
+			if item.kind != tokString {
+				return nil, fmt.Errorf("expected a literal at %d", item.pos)
+			}
+			list = append(list, item.text)
+		}
+		return list, nil
+	case t.kind == tokEOF:
+		return nil, errors.New("unexpected end")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
@@ -0,0 +1,118 @@
+package authorizer_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/go-chi/chi"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+	"github.com/bayugyug/authorizer/authorizertest"
+)
+
+var _ = Describe("Expression", func() {
+
+	var (
+		verifier *authorizer.VerifierService
+		tokens   *authorizertest.TokenFactory
+	)
+
+	BeforeEach(func() {
+		verifier = authorizertest.NewVerifier(GinkgoT())
+		tokens = authorizertest.NewTokenFactory(GinkgoT(), verifier)
+	})
+
+	sso := func(c *authorizer.AuthClaims) { c.Details.AuthType = "sso" }
+	tenants := authorizertest.WithMetaInfo(map[string]interface{}{"tenants": []interface{}{"acme", "globex"}, "level": 3})
+
+	Context("Claims and details", func() {
+		It("Prepare", func() {
+
+			claims := tokens.Claims(sso, tenants, authorizertest.WithRoles("user", "auditor"))
+			for src, expected := range map[string]bool{
+				`details.auth_type == 'sso'`:                                true,
+				`details.auth_type != "sso"`:                                false,
+				`'auditor' in claims.roles`:                                 true,
+				`['user', 'auditor'] in details.roles`:                      true,
+				`['user', 'admin'] in details.roles`:                        false,
+				`claims.meta_info.tenants == 'globex'`:                      true,
+				`claims.meta_info.level == 3`:                               true,
+				`claims.meta_info.missing == ''`:                            false,
+				`!(claims.meta_info.missing == '')`:                         true,
+				`'admin' in claims.roles || details.auth_type == 'sso'`:     true,
+				`'admin' in claims.roles && details.auth_type == 'sso'`:     false,
+				`true && !false`:                                            true,
+				`(claims.sub == 'nobody' || true) && claims.scope != 'all'`: true,
+			} {
+				e, err := authorizer.CompileExpression(src)
+				Expect(err).To(BeNil(), src)
+				Expect(e.Eval(claims, nil)).To(Equal(expected), src)
+			}
+
+			By("Claims and details ok")
+		})
+	})
+
+	Context("Compile time validation", func() {
+		It("Prepare", func() {
+
+			for _, src := range []string{
+				``,
+				`claims.sub`,
+				`claims.password == 'x'`,
+				`details.auth_token == 'x'`,
+				`request.body == 'x'`,
+				`request.header == 'x'`,
+				`tenant == 'acme'`,
+				`claims.sub == 'x' &&`,
+				`(claims.sub == 'x'`,
+				`claims.sub == 'x')`,
+				`claims.sub = 'x'`,
+				`claims.sub == 'x`,
+				`claims.sub in [claims.iss]`,
+			} {
+				_, err := authorizer.CompileExpression(src)
+				Expect(err).To(MatchError(authorizer.ErrInvalidExpression), src)
+			}
+			Expect(func() { authorizer.MustCompileExpression("claims.sub") }).To(Panic())
+
+			By("Compile time validation ok")
+		})
+	})
+
+	Context("Middleware with request attributes", func() {
+		It("Prepare", func() {
+
+			router := chi.NewRouter()
+			router.With(authorizer.ExpressionMiddleware(verifier,
+				authorizer.MustCompileExpression(`request.param.tenant in claims.meta_info.tenants`),
+				authorizer.MustCompileExpression(`request.method == 'GET' || request.header.X-Approved == 'yes'`),
+			)).HandleFunc("/tenants/{tenant}/invoices", func(w http.ResponseWriter, r *http.Request) {
+				_, ok := authorizer.ClaimsFromContext(r.Context())
+				Expect(ok).To(BeTrue())
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			serve := func(method, target, token string, header http.Header) int {
+				req := authorizertest.NewRequest(method, target, nil, authorizertest.DefaultTokenSource, token)
+				for k, v := range header {
+					req.Header[k] = v
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w.Code
+			}
+
+			token := tokens.Valid(tenants)
+			Expect(serve(http.MethodGet, "/tenants/acme/invoices", token, nil)).To(Equal(http.StatusNoContent))
+			Expect(serve(http.MethodGet, "/tenants/initech/invoices", token, nil)).To(Equal(http.StatusForbidden))
+			Expect(serve(http.MethodPost, "/tenants/acme/invoices", token, nil)).To(Equal(http.StatusForbidden))
+			Expect(serve(http.MethodPost, "/tenants/acme/invoices", token, http.Header{"X-Approved": {"yes"}})).To(Equal(http.StatusNoContent))
+			Expect(serve(http.MethodGet, "/tenants/acme/invoices", tokens.WrongKey(), nil)).To(Equal(http.StatusUnauthorized))
+
+			By("Middleware with request attributes ok")
+		})
+	})
+})
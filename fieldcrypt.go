@@ -0,0 +1,124 @@
+package authorizer
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// encryptedFieldPrefix marks an encrypted claim value: enc:<base64url nonce || ciphertext>
+	encryptedFieldPrefix = "enc:"
+)
+
+// DefaultEncryptFields encrypted when a field key is set without a list of fields
+var DefaultEncryptFields = []string{"auth_token", "refresh_token"}
+
+var (
+	// ErrInvalidFieldKey ...
+	ErrInvalidFieldKey = errors.New("field key must be a base64 AES-128/192/256 key")
+	// ErrUnknownField ...
+	ErrUnknownField = errors.New("unknown field to encrypt")
+)
+
+// encryptableFields the Details fields that can be encrypted
+var encryptableFields = map[string]func(d *Details) *string{
+	"uuid":          func(d *Details) *string { return &d.UUID },
+	"auth_token":    func(d *Details) *string { return &d.AuthToken },
+	"refresh_token": func(d *Details) *string { return &d.RefreshToken },
+	"auth_type":     func(d *Details) *string { return &d.AuthType },
+	"name":          func(d *Details) *string { return &d.Name },
+	"method":        func(d *Details) *string { return &d.Method },
+}
+
+// fieldCipher AES-GCM of the selected Details fields, the field name is the additional data
+type fieldCipher struct {
+	aead   cipher.AEAD
+	fields []string
+}
+
+// newFieldCipher nil when no key is set
+func newFieldCipher(key string, fields []string) (*fieldCipher, error) {
+	if strings.TrimSpace(key) == "" {
+		return nil, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, ErrInvalidFieldKey
+	}
+	switch len(raw) {
+	case 16, 24, 32:
+	default:
+		return nil, ErrInvalidFieldKey
+	}
+	aead, err := newGCM(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		fields = DefaultEncryptFields
+	}
+	for _, field := range fields {
+		if _, ok := encryptableFields[field]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownField, field)
+		}
+	}
+	return &fieldCipher{aead: aead, fields: append([]string(nil), fields...)}, nil
+}
+
+// encrypt the fields of a copy of the details
+func (c *fieldCipher) encrypt(details *Details) (*Details, error) {
+	if c == nil || details == nil {
+		return details, nil
+	}
+	out := *details
+	out.Roles = append([]string(nil), details.Roles...)
+	for _, field := range c.fields {
+		value := encryptableFields[field](&out)
+		if *value == "" {
+			continue
+		}
+		nonce := make([]byte, c.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		sealed := c.aead.Seal(nonce, nonce, []byte(*value), []byte(field))
+		*value = encryptedFieldPrefix + base64.RawURLEncoding.EncodeToString(sealed)
+	}
+	return &out, nil
+}
+
+// decrypt the configured fields in place, a value is only replaced when it decodes and
+// authenticates with the key: anything else ( ie: a plain "enc:foo" ) is left as is
+func (c *fieldCipher) decrypt(details *Details) {
+	if c == nil || details == nil {
+		return
+	}
+	for _, field := range c.fields {
+		value := encryptableFields[field](details)
+		if plaintext, ok := c.open(field, *value); ok {
+			*value = plaintext
+		}
+	}
+}
+
+// open ...
+func (c *fieldCipher) open(field, value string) (string, bool) {
+	encoded, ok := strings.CutPrefix(value, encryptedFieldPrefix)
+	if !ok {
+		return "", false
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < c.aead.NonceSize()+c.aead.Overhead() {
+		return "", false
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, []byte(field))
+	if err != nil {
+		return "", false
+	}
+	return string(plaintext), true
+}
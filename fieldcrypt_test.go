@@ -0,0 +1,140 @@
+package authorizer_test
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+	"github.com/bayugyug/authorizer/authorizertest"
+)
+
+var _ = Describe("FieldEncryption", func() {
+
+	var (
+		keys    = authorizertest.NewRSAKeyPair(GinkgoT(), 2048)
+		payload = &authorizer.AuthClaims{
+			Details: &authorizer.Details{
+				UUID:         "user-1001",
+				AuthToken:    "secret-auth-token",
+				RefreshToken: "secret-refresh-token",
+				Name:         "juan",
+				Roles:        []string{"admin"},
+			},
+		}
+	)
+
+	newKey := func() string {
+		raw := make([]byte, 32)
+		_, _ = rand.Read(raw)
+		return base64.StdEncoding.EncodeToString(raw)
+	}
+
+	service := func(opts ...authorizer.Option) *authorizer.VerifierService {
+		all := append([]authorizer.Option{
+			authorizer.WithKeys(keys.PrivateKey, keys.PublicKey),
+			authorizer.WithTokenSource(authorizertest.DefaultTokenSource),
+		}, opts...)
+		verifier, err := authorizer.New(all...)
+		Expect(err).To(BeNil())
+		return verifier
+	}
+
+	rawPayload := func(token string) string {
+		raw, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[1])
+		Expect(err).To(BeNil())
+		return string(raw)
+	}
+
+	Context("Encrypted fields round trip", func() {
+		It("Prepare", func() {
+
+			verifier := service(authorizer.WithFieldEncryption(newKey(), "auth_token", "refresh_token", "uuid"))
+			token, err := verifier.Sign(payload)
+			Expect(err).To(BeNil())
+
+			body := rawPayload(token)
+			Expect(body).NotTo(ContainSubstring("secret-auth-token"))
+			Expect(body).NotTo(ContainSubstring("secret-refresh-token"))
+			Expect(body).NotTo(ContainSubstring("user-1001"))
+			Expect(body).To(ContainSubstring(`"name":"juan"`))
+
+			claims, err := verifier.Verify(token)
+			Expect(err).To(BeNil())
+			Expect(claims.Details.UUID).To(Equal("user-1001"))
+			Expect(claims.Details.AuthToken).To(Equal("secret-auth-token"))
+			Expect(claims.Details.RefreshToken).To(Equal("secret-refresh-token"))
+			Expect(claims.Details.Roles).To(Equal([]string{"admin"}))
+
+			By("the payload of the caller is untouched")
+			Expect(payload.Details.AuthToken).To(Equal("secret-auth-token"))
+
+			By("Encrypted fields round trip ok")
+		})
+	})
+
+	Context("Verifiers without the field key", func() {
+		It("Prepare", func() {
+
+			key := newKey()
+			token, err := service(authorizer.WithFieldEncryption(key)).Sign(payload)
+			Expect(err).To(BeNil())
+
+			claims, err := service().Verify(token)
+			Expect(err).To(BeNil())
+			Expect(claims.Details.AuthToken).To(HavePrefix("enc:"))
+			Expect(claims.Details.UUID).To(Equal("user-1001"))
+			Expect(claims.Details.Name).To(Equal("juan"))
+
+			By("a wrong key leaves the values encrypted")
+			claims, err = service(authorizer.WithFieldEncryption(newKey())).Verify(token)
+			Expect(err).To(BeNil())
+			Expect(claims.Details.AuthToken).To(HavePrefix("enc:"))
+
+			By("Verifiers without the field key ok")
+		})
+	})
+
+	Context("Plain values with the prefix", func() {
+		It("Prepare", func() {
+
+			token, err := service().Sign(&authorizer.AuthClaims{
+				Details: &authorizer.Details{Name: "enc:foo", AuthToken: "enc:bar", RefreshToken: "enc:" + strings.Repeat("A", 40)},
+			})
+			Expect(err).To(BeNil())
+
+			claims, err := service(authorizer.WithFieldEncryption(newKey())).Verify(token)
+			Expect(err).To(BeNil())
+			Expect(claims.Details.Name).To(Equal("enc:foo"))
+			Expect(claims.Details.AuthToken).To(Equal("enc:bar"))
+			Expect(claims.Details.RefreshToken).To(Equal("enc:" + strings.Repeat("A", 40)))
+
+			By("Plain values with the prefix ok")
+		})
+	})
+
+	Context("Invalid field options", func() {
+		It("Prepare", func() {
+
+			_, err := authorizer.New(
+				authorizer.WithKeys(keys.PrivateKey, keys.PublicKey),
+				authorizer.WithTokenSource(authorizertest.DefaultTokenSource),
+				authorizer.WithFieldEncryption("not-a-key"),
+			)
+			Expect(errors.Is(err, authorizer.ErrInvalidFieldKey)).To(BeTrue())
+
+			_, err = authorizer.New(
+				authorizer.WithKeys(keys.PrivateKey, keys.PublicKey),
+				authorizer.WithTokenSource(authorizertest.DefaultTokenSource),
+				authorizer.WithFieldEncryption(newKey(), "roles"),
+			)
+			Expect(errors.Is(err, authorizer.ErrUnknownField)).To(BeTrue())
+
+			By("Invalid field options ok")
+		})
+	})
+})
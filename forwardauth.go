@@ -0,0 +1,127 @@
+package authorizer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const (
+	// IngressTraefik Traefik ForwardAuth, the original request is in the X-Forwarded-Method/Uri headers
+	IngressTraefik = "traefik"
+	// IngressNginx nginx auth_request, the original request is in the X-Original-Method/URI headers
+	IngressNginx = "nginx"
+
+	// ForwardedMethodHeader original method, Traefik ForwardAuth
+	ForwardedMethodHeader = "X-Forwarded-Method"
+	// ForwardedURIHeader original request uri, Traefik ForwardAuth
+	ForwardedURIHeader = "X-Forwarded-Uri"
+	// OriginalMethodHeader original method, nginx auth_request ( proxy_set_header X-Original-Method $request_method )
+	OriginalMethodHeader = "X-Original-Method"
+	// OriginalURIHeader original request uri, nginx auth_request ( proxy_set_header X-Original-URI $request_uri )
+	OriginalURIHeader = "X-Original-URI"
+)
+
+var (
+	// ErrUnknownIngress ...
+	ErrUnknownIngress = errors.New("unknown ingress")
+	// ErrMissingForwardedRequest ...
+	ErrMissingForwardedRequest = errors.New("missing forwarded method or uri")
+)
+
+// ingressHeaders the only method and uri headers trusted for each ingress, the ingress overwrites them,
+// the headers of the other one may come from the client as is
+var ingressHeaders = map[string][2]string{
+	IngressTraefik: {ForwardedMethodHeader, ForwardedURIHeader},
+	IngressNginx:   {OriginalMethodHeader, OriginalURIHeader},
+}
+
+// ForwardAuth handler for the ingress sub request ( nginx auth_request, Traefik ForwardAuth ).
+// Answers 200 with the claim headers, 401 on a missing/invalid token or 403 when the route denies it.
+type ForwardAuth struct {
+	verifier VerifierServiceCreator
+	ingress  string
+	routes   []ProxyRoute
+	headers  map[string]string
+}
+
+// NewForwardAuth the upstream and the forward secret of the config are not used,
+// the ingress copies the response headers to the upstream request. The ingress of the config is required.
+func NewForwardAuth(verifier VerifierServiceCreator, cfg *ProxyConfig) (*ForwardAuth, error) {
+	if cfg == nil {
+		cfg = &ProxyConfig{}
+	}
+	if _, ok := ingressHeaders[cfg.Ingress]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownIngress, cfg.Ingress)
+	}
+	headers, err := forwardHeaders(cfg.Forward.Headers)
+	if err != nil {
+		return nil, err
+	}
+	return &ForwardAuth{
+		verifier: verifier,
+		ingress:  cfg.Ingress,
+		routes:   sortRoutes(cfg.Routes),
+		headers:  headers,
+	}, nil
+}
+
+// ServeHTTP ...
+func (f *ForwardAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	original, err := ForwardedRequest(r, f.ingress)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	claims, err := f.verifier.UnSign(original)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	routePath, err := cleanPath(original.URL)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if !allowedRoute(f.routes, original.Method, routePath, claims) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	for claim, header := range f.headers {
+		w.Header().Set(header, forwardClaims[claim](claims))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// ForwardedRequest rebuild the original request of an ingress sub request from the
+// forwarded method/uri headers of the ingress ( IngressTraefik, IngressNginx ), so query token sources
+// and route policies see the real one. Both headers are required ( ErrMissingForwardedRequest ),
+// the path is cleaned ( ErrInvalidPath for encoded dots or slashes ).
+func ForwardedRequest(r *http.Request, ingress string) (*http.Request, error) {
+	names, ok := ingressHeaders[ingress]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownIngress, ingress)
+	}
+	method, uri := r.Header.Get(names[0]), r.Header.Get(names[1])
+	if method == "" || uri == "" {
+		return nil, ErrMissingForwardedRequest
+	}
+
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	// raw $request_uri, normalized the way the proxy does it
+	if u.Path, err = cleanPath(u); err != nil {
+		return nil, err
+	}
+	u.RawPath = ""
+
+	out := r.Clone(r.Context())
+	out.Method = method
+	out.URL = u
+	out.RequestURI = uri
+	return out, nil
+}
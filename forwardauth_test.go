@@ -0,0 +1,199 @@
+package authorizer_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+	"github.com/bayugyug/authorizer/authorizertest"
+)
+
+var _ = Describe("ForwardAuth", func() {
+
+	var (
+		tokens       *authorizertest.TokenFactory
+		handler      http.Handler
+		nginxHandler http.Handler
+	)
+
+	BeforeEach(func() {
+		verifier := authorizertest.NewVerifier(GinkgoT())
+		tokens = authorizertest.NewTokenFactory(GinkgoT(), verifier)
+
+		newHandler := func(ingress string) http.Handler {
+			forwardAuth, err := authorizer.NewForwardAuth(verifier, &authorizer.ProxyConfig{
+				Routes: []authorizer.ProxyRoute{
+					{Prefix: "/orders/", Methods: []string{http.MethodDelete}, Roles: []string{"admin"}},
+					{Prefix: "/orders/", Roles: []string{"user", "admin"}},
+				},
+				Forward: authorizer.ProxyForward{
+					Headers: map[string]string{"sub": "X-Auth-Subject", "roles": "X-Auth-Roles"},
+				},
+				Ingress: ingress,
+			})
+			Expect(err).To(BeNil())
+			return forwardAuth
+		}
+		handler = newHandler(authorizer.IngressTraefik)
+		nginxHandler = newHandler(authorizer.IngressNginx)
+	})
+
+	// auth sub request the way nginx sends it, the client headers are passed along
+	nginxSubRequest := func(method, uri, token string, clientHeaders map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+		for name, value := range clientHeaders {
+			req.Header.Set(name, value)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if method != "" {
+			req.Header.Set(authorizer.OriginalMethodHeader, method)
+		}
+		if uri != "" {
+			req.Header.Set(authorizer.OriginalURIHeader, uri)
+		}
+		w := httptest.NewRecorder()
+		nginxHandler.ServeHTTP(w, req)
+		return w
+	}
+
+	// auth sub request the way the ingress sends it
+	subRequest := func(method, uri, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.Header.Set(authorizer.ForwardedMethodHeader, method)
+		req.Header.Set(authorizer.ForwardedURIHeader, uri)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	Context("Allowed with claim headers", func() {
+		It("Prepare", func() {
+
+			w := subRequest(http.MethodGet, "/orders/1001", tokens.Valid(authorizertest.WithSubject("user-1001"), authorizertest.WithRoles("user")))
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Header().Get("X-Auth-Subject")).To(Equal("user-1001"))
+			Expect(w.Header().Get("X-Auth-Roles")).To(Equal("user"))
+
+			By("Allowed with claim headers ok")
+		})
+	})
+
+	Context("Forwarded method in the route policy", func() {
+		It("Prepare", func() {
+
+			user := tokens.Valid(authorizertest.WithRoles("user"))
+			Expect(subRequest(http.MethodDelete, "/orders/1001", user).Code).To(Equal(http.StatusForbidden))
+			Expect(subRequest(http.MethodDelete, "/orders/1001", tokens.Valid(authorizertest.WithRoles("admin"))).Code).To(Equal(http.StatusOK))
+			Expect(subRequest(http.MethodGet, "/orders/1001", tokens.Valid(authorizertest.WithRoles("guest"))).Code).To(Equal(http.StatusForbidden))
+
+			By("Forwarded method in the route policy ok")
+		})
+	})
+
+	Context("Token from the forwarded query", func() {
+		It("Prepare", func() {
+
+			w := nginxSubRequest(http.MethodGet, "/reports?"+authorizer.DefaultGetQueryParam+"="+tokens.Valid(), "", nil)
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			By("Token from the forwarded query ok")
+		})
+	})
+
+	Context("Routes match the cleaned path", func() {
+		It("Prepare", func() {
+
+			guest := tokens.Valid(authorizertest.WithRoles("guest"))
+			for _, uri := range []string{"/public/../orders/1001", "/ORDERS/1001", "/Orders/./1001", "/orders"} {
+				Expect(subRequest(http.MethodGet, uri, guest).Code).To(Equal(http.StatusForbidden), uri)
+			}
+			for _, uri := range []string{"/public/%2e%2e/orders/1001", "/public/%2E%2E/orders/1001", "/orders%2f1001"} {
+				Expect(subRequest(http.MethodGet, uri, guest).Code).To(Equal(http.StatusBadRequest), uri)
+			}
+			Expect(subRequest(http.MethodGet, "/orders-archive/1001", guest).Code).To(Equal(http.StatusOK))
+
+			// nginx $request_uri too
+			req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+			req.Header.Set("Authorization", "Bearer "+guest)
+			req.Header.Set(authorizer.OriginalMethodHeader, http.MethodGet)
+			req.Header.Set(authorizer.OriginalURIHeader, "/reports/../orders/1001?page=2")
+			original, err := authorizer.ForwardedRequest(req, authorizer.IngressNginx)
+			Expect(err).To(BeNil())
+			Expect(original.URL.Path).To(Equal("/orders/1001"))
+			w := httptest.NewRecorder()
+			nginxHandler.ServeHTTP(w, req)
+			Expect(w.Code).To(Equal(http.StatusForbidden))
+
+			By("Routes match the cleaned path ok")
+		})
+	})
+
+	Context("Only the headers of the ingress", func() {
+		It("Prepare", func() {
+
+			// nginx passes the client headers along, a client X-Forwarded-Uri must not pick the route
+			guest := tokens.Valid(authorizertest.WithRoles("guest"))
+			spoofed := map[string]string{
+				authorizer.ForwardedMethodHeader: http.MethodGet,
+				authorizer.ForwardedURIHeader:    "/public/1001",
+			}
+			Expect(nginxSubRequest(http.MethodDelete, "/orders/1001", guest, spoofed).Code).To(Equal(http.StatusForbidden))
+			Expect(nginxSubRequest("", "", guest, spoofed).Code).To(Equal(http.StatusBadRequest))
+
+			// and the other way around behind traefik
+			req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+			req.Header.Set("Authorization", "Bearer "+guest)
+			req.Header.Set(authorizer.OriginalMethodHeader, http.MethodGet)
+			req.Header.Set(authorizer.OriginalURIHeader, "/public/1001")
+			_, err := authorizer.ForwardedRequest(req, authorizer.IngressTraefik)
+			Expect(err).To(MatchError(authorizer.ErrMissingForwardedRequest))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			Expect(w.Code).To(Equal(http.StatusBadRequest))
+
+			By("Only the headers of the ingress ok")
+		})
+	})
+
+	Context("Missing forwarded headers", func() {
+		It("Prepare", func() {
+
+			// never the path of the sub request itself
+			user := tokens.Valid(authorizertest.WithRoles("user"))
+			Expect(nginxSubRequest("", "", user, nil).Code).To(Equal(http.StatusBadRequest))
+			Expect(nginxSubRequest(http.MethodGet, "", user, nil).Code).To(Equal(http.StatusBadRequest))
+			Expect(nginxSubRequest("", "/orders/1001", user, nil).Code).To(Equal(http.StatusBadRequest))
+			Expect(nginxSubRequest(http.MethodGet, "/orders/1001", user, nil).Code).To(Equal(http.StatusOK))
+
+			_, err := authorizer.NewForwardAuth(authorizertest.NewVerifier(GinkgoT()), &authorizer.ProxyConfig{})
+			Expect(err).To(MatchError(authorizer.ErrUnknownIngress))
+			_, err = authorizer.ForwardedRequest(httptest.NewRequest(http.MethodGet, "/auth", nil), "haproxy")
+			Expect(err).To(MatchError(authorizer.ErrUnknownIngress))
+
+			By("Missing forwarded headers ok")
+		})
+	})
+
+	Context("Rejected", func() {
+		It("Prepare", func() {
+
+			w := subRequest(http.MethodGet, "/reports", "")
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			Expect(w.Header().Get("WWW-Authenticate")).To(ContainSubstring("invalid_token"))
+			Expect(w.Header().Get("X-Auth-Subject")).To(BeEmpty())
+
+			Expect(subRequest(http.MethodGet, "/reports", tokens.Expired()).Code).To(Equal(http.StatusUnauthorized))
+			Expect(subRequest(http.MethodGet, "::not-a-uri", tokens.Valid()).Code).To(Equal(http.StatusBadRequest))
+
+			By("Rejected ok")
+		})
+	})
+})
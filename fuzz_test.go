@@ -0,0 +1,97 @@
+package authorizer_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/bayugyug/authorizer"
+)
+
+func FuzzGetTokenFromAuthBearer(f *testing.F) {
+	for _, seed := range []string{
+		"", "Bearer", "Bearer ", "Bearer abc", "bearer  abc ", "BEARER\tabc",
+		"XBearer abc", "Bearerxabc", "Basic dXNlcjpwYXNz", "Bearer a.b.c",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, header string) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", header)
+		token := authorizer.GetTokenFromAuthBearer(req)
+		if token == "" {
+			return
+		}
+		raw := req.Header.Get("Authorization")
+		if token != strings.TrimSpace(token) {
+			t.Fatalf("untrimmed token %q from %q", token, raw)
+		}
+		if !strings.EqualFold(raw[:7], "bearer ") {
+			t.Fatalf("token %q from a non bearer header %q", token, raw)
+		}
+		if !strings.Contains(raw, token) {
+			t.Fatalf("token %q not part of %q", token, raw)
+		}
+	})
+}
+
+func FuzzParsePublicKey(f *testing.F) {
+	for _, key := range loadConformance().Keys {
+		f.Add(key)
+	}
+	f.Add("-----BEGIN RSA PUBLIC KEY-----\n-----END RSA PUBLIC KEY-----")
+	f.Add("")
+	f.Fuzz(func(t *testing.T, key string) {
+		pub, err := authorizer.ParsePublicKey(key)
+		if err == nil && pub == nil {
+			t.Fatalf("nil key without error for %q", key)
+		}
+		// the legacy key func must agree with the parser on RSA keys
+		token := &jwt.Token{Method: jwt.SigningMethodRS256, Header: map[string]interface{}{"alg": "RS256"}}
+		if rsaPub, err := authorizer.GetPublicKey(key)(token); err == nil && rsaPub == nil {
+			t.Fatalf("nil rsa key without error for %q", key)
+		}
+	})
+}
+
+func FuzzVerify(f *testing.F) {
+	corpus := loadConformance()
+	for _, vector := range corpus.Vectors {
+		f.Add(vector.Token)
+	}
+	rsaVerifier := authorizer.NewTypedVerifierService[interface{}](&authorizer.Options{
+		PublicKey: corpus.Keys["rfc7515-a2"],
+	})
+	ecVerifier := authorizer.NewTypedVerifierService[interface{}](&authorizer.Options{
+		PublicKey: corpus.Keys["rfc7515-a3"],
+	})
+	f.Fuzz(func(t *testing.T, token string) {
+		// only a RS* token can verify against a RSA key and only a ES* token against an EC key
+		if claims, err := rsaVerifier.Verify(token); err == nil {
+			if claims == nil {
+				t.Fatalf("nil claims without error for %q", token)
+			}
+			parsed, _, err := new(jwt.Parser).ParseUnverified(token, &jwt.StandardClaims{})
+			if err != nil {
+				t.Fatalf("accepted an unparsable token %q", token)
+			}
+			if _, ok := parsed.Method.(*jwt.SigningMethodRSA); !ok {
+				t.Fatalf("accepted a non RSA token %q on a RSA key", token)
+			}
+		}
+		if claims, err := ecVerifier.Verify(token); err == nil {
+			if claims == nil {
+				t.Fatalf("nil claims without error for %q", token)
+			}
+			parsed, _, err := new(jwt.Parser).ParseUnverified(token, &jwt.StandardClaims{})
+			if err != nil {
+				t.Fatalf("accepted an unparsable token %q", token)
+			}
+			if _, ok := parsed.Method.(*jwt.SigningMethodECDSA); !ok {
+				t.Fatalf("accepted a non ECDSA token %q on an EC key", token)
+			}
+		}
+	})
+}
@@ -0,0 +1,730 @@
+package authorizer
+
+import (
+	"bytes"
+	"container/heap"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SignatureInputHeader RFC 9421
+	SignatureInputHeader = "Signature-Input"
+	// SignatureHeader RFC 9421
+	SignatureHeader = "Signature"
+	// ContentDigestHeader RFC 9530
+	ContentDigestHeader = "Content-Digest"
+	// DefaultSignatureLabel ...
+	DefaultSignatureLabel = "sig1"
+	// DefaultMessageMaxAge how old the created parameter may be when MaxAge is not set
+	DefaultMessageMaxAge = 5 * time.Minute
+	// DefaultNonceCacheSize nonces remembered by NewNonceCache
+	DefaultNonceCacheSize = 100000
+
+	// RFC 9421 algorithms of the service keys, P-521 has none
+	algRSAv15SHA256  = "rsa-v1_5-sha256"
+	algRSAPSSSHA512  = "rsa-pss-sha512"
+	algECDSAP256     = "ecdsa-p256-sha256"
+	algECDSAP384     = "ecdsa-p384-sha384"
+	messageClockSkew = time.Minute
+)
+
+// DefaultMessageComponents signed when MessageSignatureOptions.Components is empty
+var DefaultMessageComponents = []string{"@method", "@authority", "@path", "@query", "content-digest"}
+
+// messageJWSAlgorithms the JWS alg of each RFC 9421 algorithm, checked against Options.Algorithms
+var messageJWSAlgorithms = map[string]string{
+	algRSAv15SHA256: "RS256",
+	algRSAPSSSHA512: "PS512",
+	algECDSAP256:    "ES256",
+	algECDSAP384:    "ES384",
+}
+
+var (
+	// ErrMissingMessageSignature ...
+	ErrMissingMessageSignature = errors.New("missing message signature")
+	// ErrInvalidMessageSignature ...
+	ErrInvalidMessageSignature = errors.New("invalid message signature")
+	// ErrExpiredMessageSignature ...
+	ErrExpiredMessageSignature = errors.New("expired message signature")
+	// ErrMissingComponent ...
+	ErrMissingComponent = errors.New("missing signed component")
+	// ErrContentDigestMismatch ...
+	ErrContentDigestMismatch = errors.New("content digest mismatch")
+	// ErrReplayedNonce ...
+	ErrReplayedNonce = errors.New("replayed nonce")
+)
+
+// MessageSignatureOptions of the RFC 9421 signer and verifier
+type MessageSignatureOptions struct {
+	// Label of the signature, "sig1" by default
+	Label string
+	// KeyID keyid parameter, checked by the verifier when set
+	KeyID string
+	// Components signed by the signer, required to be covered by the verifier.
+	// Derived ones ( @method, @authority, @scheme, @target-uri, @request-target, @path, @query )
+	// or lower case header names, ie: content-digest, content-type
+	Components []string
+	// TTL signer: expires = created + TTL, none when zero
+	TTL time.Duration
+	// Nonce signer: add a random nonce
+	Nonce bool
+	// MaxAge verifier: oldest created accepted, DefaultMessageMaxAge when zero
+	MaxAge time.Duration
+	// Nonces verifier: when set a nonce is required and can be seen only once
+	Nonces NonceChecker
+}
+
+// NonceChecker replay protection of the verifier
+type NonceChecker interface {
+	// CheckNonce false when the nonce was already seen, else remember it until the time given
+	CheckNonce(nonce string, until time.Time) bool
+}
+
+// NonceCache in memory NonceChecker, bounded: once full the new nonces are rejected
+// until the remembered ones expire ( evicting them would let them be replayed )
+type NonceCache struct {
+	mu     sync.Mutex
+	size   int
+	nonces map[string]time.Time
+	expiry expiryHeap
+}
+
+// NewNonceCache of DefaultNonceCacheSize nonces
+func NewNonceCache() *NonceCache {
+	return NewNonceCacheSize(DefaultNonceCacheSize)
+}
+
+// NewNonceCacheSize DefaultNonceCacheSize when size is not positive
+func NewNonceCacheSize(size int) *NonceCache {
+	if size <= 0 {
+		size = DefaultNonceCacheSize
+	}
+	return &NonceCache{size: size, nonces: make(map[string]time.Time)}
+}
+
+// CheckNonce false when seen or when the cache is full
+func (c *NonceCache) CheckNonce(nonce string, until time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expiry.popExpired(time.Now(), func(entry expiryEntry) {
+		delete(c.nonces, entry.key)
+	})
+	if _, seen := c.nonces[nonce]; seen {
+		return false
+	}
+	if len(c.nonces) >= c.size {
+		return false
+	}
+	c.nonces[nonce] = until
+	heap.Push(&c.expiry, expiryEntry{key: nonce, until: until})
+	return true
+}
+
+// MessageSigner sign outgoing requests with the service private key
+type MessageSigner struct {
+	opts MessageSignatureOptions
+	key  crypto.Signer
+	alg  string
+}
+
+// NewMessageSigner ...
+func (s *TypedVerifierService[T]) NewMessageSigner(opts MessageSignatureOptions) (*MessageSigner, error) {
+	if s.privateErr != nil {
+		return nil, s.privateErr
+	}
+	key, ok := s.privateKey.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+	alg, err := messageAlgorithm(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &MessageSigner{opts: messageOptions(opts), key: key, alg: alg}, nil
+}
+
+// Sign add the Signature-Input and Signature headers ( and Content-Digest when covered )
+func (m *MessageSigner) Sign(r *http.Request) error {
+	for _, c := range m.opts.Components {
+		if c == "content-digest" {
+			if err := setContentDigest(r); err != nil {
+				return err
+			}
+		}
+	}
+
+	now := time.Now()
+	params := fmt.Sprintf(";created=%d", now.Unix())
+	if m.opts.TTL > 0 {
+		params += fmt.Sprintf(";expires=%d", now.Add(m.opts.TTL).Unix())
+	}
+	if m.opts.Nonce {
+		raw := make([]byte, 16)
+		if _, err := rand.Read(raw); err != nil {
+			return err
+		}
+		params += fmt.Sprintf(";nonce=%q", base64.RawURLEncoding.EncodeToString(raw))
+	}
+	if m.opts.KeyID != "" {
+		params += fmt.Sprintf(";keyid=%q", m.opts.KeyID)
+	}
+	params += fmt.Sprintf(";alg=%q", m.alg)
+
+	quoted := make([]string, 0, len(m.opts.Components))
+	for _, c := range m.opts.Components {
+		quoted = append(quoted, strconv.Quote(c))
+	}
+	signatureParams := "(" + strings.Join(quoted, " ") + ")" + params
+
+	base, err := signatureBase(r, m.opts.Components, signatureParams)
+	if err != nil {
+		return err
+	}
+	sig, err := signMessage(m.key, m.alg, base)
+	if err != nil {
+		return err
+	}
+	r.Header.Set(SignatureInputHeader, m.opts.Label+"="+signatureParams)
+	r.Header.Set(SignatureHeader, m.opts.Label+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+	return nil
+}
+
+// RoundTripper sign every outgoing request, http.DefaultTransport when next is nil
+func (m *MessageSigner) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		out := r.Clone(r.Context())
+		if err := m.Sign(out); err != nil {
+			return nil, err
+		}
+		return next.RoundTrip(out)
+	})
+}
+
+// roundTripperFunc ...
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+// RoundTrip ...
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// MessageVerifier verify incoming requests with the service public key
+type MessageVerifier struct {
+	opts       MessageSignatureOptions
+	key        crypto.PublicKey
+	alg        string
+	algorithms []string // Options.Algorithms of the service, any when empty
+}
+
+// NewMessageVerifier the algorithm of the key must be allowed by the Options.Algorithms of the service
+func (s *TypedVerifierService[T]) NewMessageVerifier(opts MessageSignatureOptions) (*MessageVerifier, error) {
+	if s.publicErr != nil {
+		return nil, s.publicErr
+	}
+	alg, err := messageAlgorithm(s.publicKey)
+	if err != nil {
+		return nil, err
+	}
+	opts = messageOptions(opts)
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = DefaultMessageMaxAge
+	}
+	v := &MessageVerifier{opts: opts, key: s.publicKey, alg: alg, algorithms: s.opts.Algorithms}
+	if err := v.checkAlgorithm(alg); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Verify the signature of the label, the covered components, created/expires, the nonce and the content digest
+func (v *MessageVerifier) Verify(r *http.Request) error {
+	inputs, err := parseSignatureDictionary(r.Header.Get(SignatureInputHeader))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMessageSignature, err)
+	}
+	signatures, err := parseSignatureDictionary(r.Header.Get(SignatureHeader))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMessageSignature, err)
+	}
+	signatureParams, ok := inputs[v.opts.Label]
+	if !ok {
+		return ErrMissingMessageSignature
+	}
+	rawSig, ok := signatures[v.opts.Label]
+	if !ok || len(rawSig) < 2 || rawSig[0] != ':' || rawSig[len(rawSig)-1] != ':' {
+		return ErrMissingMessageSignature
+	}
+	sig, err := base64.StdEncoding.DecodeString(rawSig[1 : len(rawSig)-1])
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMessageSignature, err)
+	}
+
+	components, params, err := parseSignatureParams(signatureParams)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMessageSignature, err)
+	}
+	if err := v.checkParams(components, params); err != nil {
+		return err
+	}
+	// the key algorithm unless the signer declared another one of the key type
+	alg := v.alg
+	if declared, ok := params["alg"]; ok {
+		alg = declared
+	}
+
+	base, err := signatureBase(r, components, signatureParams)
+	if err != nil {
+		return err
+	}
+	if err := verifyMessage(v.key, alg, base, sig); err != nil {
+		return err
+	}
+
+	// only after the signature, the nonce of a forged request must not be burnt
+	if v.opts.Nonces != nil {
+		until := time.Unix(params.int("created"), 0).Add(v.opts.MaxAge)
+		if !v.opts.Nonces.CheckNonce(params["nonce"], until) {
+			return ErrReplayedNonce
+		}
+	}
+	for _, c := range components {
+		if c == "content-digest" {
+			return checkContentDigest(r)
+		}
+	}
+	return nil
+}
+
+// checkParams ...
+func (v *MessageVerifier) checkParams(components []string, params signatureParamValues) error {
+	covered := make(map[string]bool, len(components))
+	for _, c := range components {
+		covered[c] = true
+	}
+	for _, c := range v.opts.Components {
+		if !covered[c] {
+			return fmt.Errorf("%w: %s", ErrMissingComponent, c)
+		}
+	}
+	if alg, ok := params["alg"]; ok {
+		if alg != v.alg && !(v.alg == algRSAv15SHA256 && alg == algRSAPSSSHA512) {
+			return fmt.Errorf("%w: unexpected alg %s", ErrInvalidMessageSignature, alg)
+		}
+		if err := v.checkAlgorithm(alg); err != nil {
+			return err
+		}
+	}
+	if v.opts.KeyID != "" && params["keyid"] != v.opts.KeyID {
+		return fmt.Errorf("%w: unexpected keyid", ErrInvalidMessageSignature)
+	}
+
+	now := time.Now()
+	if _, ok := params["created"]; !ok {
+		return fmt.Errorf("%w: missing created", ErrInvalidMessageSignature)
+	}
+	created := time.Unix(params.int("created"), 0)
+	if created.After(now.Add(messageClockSkew)) || now.Sub(created) > v.opts.MaxAge {
+		return ErrExpiredMessageSignature
+	}
+	if _, ok := params["expires"]; ok && now.After(time.Unix(params.int("expires"), 0)) {
+		return ErrExpiredMessageSignature
+	}
+	if v.opts.Nonces != nil && params["nonce"] == "" {
+		return fmt.Errorf("%w: missing nonce", ErrInvalidMessageSignature)
+	}
+	return nil
+}
+
+// checkAlgorithm the JWS alg of the RFC 9421 algorithm must be in the allowlist when there is one
+func (v *MessageVerifier) checkAlgorithm(alg string) error {
+	if len(v.algorithms) > 0 && !anyEqual(v.algorithms, []string{messageJWSAlgorithms[alg]}) {
+		return fmt.Errorf("%w: %s", ErrAlgorithmNotAllowed, alg)
+	}
+	return nil
+}
+
+// Middleware chi compatible, 401 when the request signature does not verify, 413 over DefaultMaxBodyBytes
+func (v *MessageVerifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = http.MaxBytesReader(w, r.Body, DefaultMaxBodyBytes)
+		}
+		if err := v.Verify(r); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Signature error="invalid_signature"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// messageOptions defaults of the label and components
+func messageOptions(opts MessageSignatureOptions) MessageSignatureOptions {
+	if opts.Label == "" {
+		opts.Label = DefaultSignatureLabel
+	}
+	if len(opts.Components) == 0 {
+		opts.Components = DefaultMessageComponents
+	}
+	components := make([]string, 0, len(opts.Components))
+	for _, c := range opts.Components {
+		components = append(components, strings.ToLower(c))
+	}
+	opts.Components = components
+	return opts
+}
+
+// messageAlgorithm the RFC 9421 algorithm of the key, there is none for P-521 ( ES512 ) keys
+func messageAlgorithm(key crypto.PublicKey) (string, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return algRSAv15SHA256, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return algECDSAP256, nil
+		case elliptic.P384():
+			return algECDSAP384, nil
+		}
+		return "", fmt.Errorf("%w: no RFC 9421 algorithm for %s", ErrUnsupportedKey, k.Curve.Params().Name)
+	}
+	return "", ErrUnsupportedKey
+}
+
+// signMessage ...
+func signMessage(key crypto.Signer, alg string, base []byte) ([]byte, error) {
+	switch alg {
+	case algRSAv15SHA256:
+		sum := sha256.Sum256(base)
+		return key.Sign(rand.Reader, sum[:], crypto.SHA256)
+	case algECDSAP256, algECDSAP384:
+		ecKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, ErrUnsupportedKey
+		}
+		digest := messageDigest(alg, base)
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest)
+		if err != nil {
+			return nil, err
+		}
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		out := make([]byte, 2*size)
+		r.FillBytes(out[:size])
+		s.FillBytes(out[size:])
+		return out, nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// verifyMessage with the given algorithm only, rsa-v1_5-sha256 or rsa-pss-sha512 for RSA keys
+func verifyMessage(key crypto.PublicKey, alg string, base, sig []byte) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg {
+		case algRSAv15SHA256:
+			sum := sha256.Sum256(base)
+			if rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) == nil {
+				return nil
+			}
+		case algRSAPSSSHA512:
+			sum := sha512.Sum512(base)
+			if rsa.VerifyPSS(k, crypto.SHA512, sum[:], sig, nil) == nil {
+				return nil
+			}
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) == 2*size {
+			r := new(big.Int).SetBytes(sig[:size])
+			s := new(big.Int).SetBytes(sig[size:])
+			if ecdsa.Verify(k, messageDigest(alg, base), r, s) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidMessageSignature
+}
+
+// messageDigest ...
+func messageDigest(alg string, base []byte) []byte {
+	if alg == algECDSAP384 {
+		sum := sha512.Sum384(base)
+		return sum[:]
+	}
+	sum := sha256.Sum256(base)
+	return sum[:]
+}
+
+// signatureBase RFC 9421 section 2.5
+func signatureBase(r *http.Request, components []string, signatureParams string) ([]byte, error) {
+	var b bytes.Buffer
+	for _, c := range components {
+		value, err := componentValue(r, c)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "%q: %s\n", c, value)
+	}
+	fmt.Fprintf(&b, "%q: %s", "@signature-params", signatureParams)
+	return b.Bytes(), nil
+}
+
+// componentValue derived components or the header values
+func componentValue(r *http.Request, component string) (string, error) {
+	path := r.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	switch component {
+	case "@method":
+		return r.Method, nil
+	case "@authority":
+		return requestAuthority(r), nil
+	case "@scheme":
+		return requestScheme(r), nil
+	case "@path":
+		return path, nil
+	case "@query":
+		return "?" + r.URL.RawQuery, nil
+	case "@request-target":
+		if r.URL.RawQuery != "" {
+			return path + "?" + r.URL.RawQuery, nil
+		}
+		return path, nil
+	case "@target-uri":
+		target := requestScheme(r) + "://" + requestAuthority(r) + path
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		return target, nil
+	}
+	if strings.HasPrefix(component, "@") {
+		return "", fmt.Errorf("%w: unsupported %s", ErrMissingComponent, component)
+	}
+	values := r.Header.Values(component)
+	if len(values) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrMissingComponent, component)
+	}
+	trimmed := make([]string, 0, len(values))
+	for _, v := range values {
+		trimmed = append(trimmed, strings.TrimSpace(v))
+	}
+	return strings.Join(trimmed, ", "), nil
+}
+
+// requestAuthority the host of the server or of the client request
+func requestAuthority(r *http.Request) string {
+	if r.Host != "" {
+		return strings.ToLower(r.Host)
+	}
+	return strings.ToLower(r.URL.Host)
+}
+
+// requestScheme ...
+func requestScheme(r *http.Request) string {
+	if r.URL.Scheme != "" {
+		return strings.ToLower(r.URL.Scheme)
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// setContentDigest sha-256 of the body, the body is restored
+func setContentDigest(r *http.Request) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(body)
+	r.Header.Set(ContentDigestHeader, "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+	return nil
+}
+
+// checkContentDigest the sha-256 member must match the body, the body is restored.
+// At most DefaultMaxBodyBytes are read ( *http.MaxBytesError over it ).
+func checkContentDigest(r *http.Request) error {
+	digests, err := parseSignatureDictionary(r.Header.Get(ContentDigestHeader))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrContentDigestMismatch, err)
+	}
+	expected, ok := digests["sha-256"]
+	if !ok {
+		return ErrContentDigestMismatch
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = http.MaxBytesReader(nil, r.Body, DefaultMaxBodyBytes)
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(body)
+	actual := ":" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) != 1 {
+		return ErrContentDigestMismatch
+	}
+	return nil
+}
+
+// readBody read and put back the body
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
+
+// parseSignatureDictionary split a structured field dictionary ( RFC 8941 ) in raw member values
+func parseSignatureDictionary(header string) (map[string]string, error) {
+	members := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return members, nil
+	}
+	var (
+		start   int
+		depth   int
+		quoted  bool
+		escaped bool
+	)
+	add := func(member string) error {
+		key, value, ok := strings.Cut(strings.TrimSpace(member), "=")
+		if !ok || key == "" {
+			return fmt.Errorf("bad member %q", member)
+		}
+		members[key] = value
+		return nil
+	}
+	for i := 0; i < len(header); i++ {
+		c := header[i]
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			if err := add(header[start:i]); err != nil {
+				return nil, err
+			}
+			start = i + 1
+		}
+	}
+	if quoted || depth != 0 {
+		return nil, errors.New("unbalanced member")
+	}
+	if err := add(header[start:]); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// signatureParamValues ...
+type signatureParamValues map[string]string
+
+// int ...
+func (p signatureParamValues) int(key string) int64 {
+	v, _ := strconv.ParseInt(p[key], 10, 64)
+	return v
+}
+
+// parseSignatureParams ("@method" "content-digest");created=1;keyid="k"
+func parseSignatureParams(raw string) ([]string, signatureParamValues, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.HasPrefix(raw, "(") {
+		return nil, nil, errors.New("expected an inner list")
+	}
+	end := strings.IndexByte(raw, ')')
+	if end < 0 {
+		return nil, nil, errors.New("unterminated inner list")
+	}
+
+	var components []string
+	for _, item := range strings.Fields(raw[1:end]) {
+		c, err := strconv.Unquote(item)
+		if err != nil || strings.ContainsAny(item, ";") {
+			return nil, nil, fmt.Errorf("bad component %s", item)
+		}
+		components = append(components, c)
+	}
+
+	params := signatureParamValues{}
+	rest := raw[end+1:]
+	for rest != "" {
+		if rest[0] != ';' {
+			return nil, nil, errors.New("bad parameters")
+		}
+		rest = rest[1:]
+		key := rest
+		if i := strings.IndexAny(rest, "=;"); i >= 0 {
+			key = rest[:i]
+		}
+		rest = rest[len(key):]
+		value := "?1" // boolean parameter
+		if strings.HasPrefix(rest, "=\"") {
+			i := 2
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(rest) {
+				return nil, nil, errors.New("unterminated parameter")
+			}
+			unquoted, err := strconv.Unquote(rest[1 : i+1])
+			if err != nil {
+				return nil, nil, fmt.Errorf("bad parameter %s", key)
+			}
+			value, rest = unquoted, rest[i+1:]
+		} else if strings.HasPrefix(rest, "=") {
+			value = rest[1:]
+			if i := strings.IndexByte(value, ';'); i >= 0 {
+				value = value[:i]
+			}
+			rest = rest[1+len(value):]
+		}
+		params[strings.TrimSpace(key)] = value
+	}
+	return components, params, nil
+}
@@ -0,0 +1,241 @@
+package authorizer_test
+
+import (
+	"crypto/elliptic"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+	"github.com/bayugyug/authorizer/authorizertest"
+)
+
+var _ = Describe("MessageSignatures", func() {
+
+	service := func(keys authorizertest.KeyPair) *authorizer.VerifierService {
+		verifier, err := authorizer.New(authorizer.WithKeys(keys.PrivateKey, keys.PublicKey), authorizer.WithTokenSource(authorizertest.DefaultTokenSource))
+		Expect(err).To(BeNil())
+		return verifier
+	}
+
+	signedRequest := func(signer *authorizer.MessageSigner, body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "https://api.example.com/orders?dry_run=1", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		Expect(signer.Sign(req)).To(Succeed())
+		return req
+	}
+
+	Context("RoundTripper to middleware", func() {
+		It("Prepare", func() {
+
+			for name, keys := range map[string]authorizertest.KeyPair{
+				"RSA":   authorizertest.NewRSAKeyPair(GinkgoT(), 2048),
+				"P-256": authorizertest.NewECKeyPair(GinkgoT(), elliptic.P256()),
+				"P-384": authorizertest.NewECKeyPair(GinkgoT(), elliptic.P384()),
+			} {
+				verifier := service(keys)
+				signer, err := verifier.NewMessageSigner(authorizer.MessageSignatureOptions{KeyID: "svc-orders", TTL: time.Minute, Nonce: true})
+				Expect(err).To(BeNil(), name)
+				checker, err := verifier.NewMessageVerifier(authorizer.MessageSignatureOptions{KeyID: "svc-orders", Nonces: authorizer.NewNonceCache()})
+				Expect(err).To(BeNil(), name)
+
+				var seen string
+				server := httptest.NewServer(checker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					raw, _ := io.ReadAll(r.Body)
+					seen = string(raw)
+					w.WriteHeader(http.StatusAccepted)
+				})))
+
+				client := &http.Client{Transport: signer.RoundTripper(nil)}
+				res, err := client.Post(server.URL+"/orders?dry_run=1", "application/json", strings.NewReader(`{"sku":"A-1"}`))
+				Expect(err).To(BeNil(), name)
+				_ = res.Body.Close()
+				Expect(res.StatusCode).To(Equal(http.StatusAccepted), name)
+				Expect(seen).To(Equal(`{"sku":"A-1"}`), name)
+
+				// unsigned
+				res, err = http.Post(server.URL+"/orders", "application/json", strings.NewReader(`{}`))
+				Expect(err).To(BeNil(), name)
+				_ = res.Body.Close()
+				Expect(res.StatusCode).To(Equal(http.StatusUnauthorized), name)
+				server.Close()
+			}
+
+			By("RoundTripper to middleware ok")
+		})
+	})
+
+	Context("Tampered requests", func() {
+		It("Prepare", func() {
+
+			verifier := service(authorizertest.NewRSAKeyPair(GinkgoT(), 2048))
+			signer, err := verifier.NewMessageSigner(authorizer.MessageSignatureOptions{})
+			Expect(err).To(BeNil())
+			checker, err := verifier.NewMessageVerifier(authorizer.MessageSignatureOptions{})
+			Expect(err).To(BeNil())
+
+			Expect(checker.Verify(signedRequest(signer, `{"amount":10}`))).To(Succeed())
+
+			req := signedRequest(signer, `{"amount":10}`)
+			req.Body = io.NopCloser(strings.NewReader(`{"amount":1000}`))
+			Expect(checker.Verify(req)).To(MatchError(authorizer.ErrContentDigestMismatch))
+
+			req = signedRequest(signer, `{"amount":10}`)
+			req.URL.Path = "/refunds"
+			Expect(checker.Verify(req)).To(MatchError(authorizer.ErrInvalidMessageSignature))
+
+			req = signedRequest(signer, `{"amount":10}`)
+			req.Method = http.MethodPut
+			Expect(checker.Verify(req)).To(MatchError(authorizer.ErrInvalidMessageSignature))
+
+			req = signedRequest(signer, `{"amount":10}`)
+			req.Header.Set(authorizer.SignatureInputHeader, strings.Replace(req.Header.Get(authorizer.SignatureInputHeader), `"@query" `, "", 1))
+			Expect(checker.Verify(req)).To(MatchError(authorizer.ErrMissingComponent))
+
+			// another key
+			other := service(authorizertest.NewRSAKeyPair(GinkgoT(), 2048))
+			otherSigner, err := other.NewMessageSigner(authorizer.MessageSignatureOptions{})
+			Expect(err).To(BeNil())
+			Expect(checker.Verify(signedRequest(otherSigner, `{}`))).To(MatchError(authorizer.ErrInvalidMessageSignature))
+
+			Expect(checker.Verify(httptest.NewRequest(http.MethodGet, "/orders", nil))).To(MatchError(authorizer.ErrMissingMessageSignature))
+
+			By("Tampered requests ok")
+		})
+	})
+
+	Context("Created, expires, nonce and keyid", func() {
+		It("Prepare", func() {
+
+			verifier := service(authorizertest.NewECKeyPair(GinkgoT(), elliptic.P256()))
+			signer, err := verifier.NewMessageSigner(authorizer.MessageSignatureOptions{Nonce: true, KeyID: "k1", TTL: time.Minute})
+			Expect(err).To(BeNil())
+			checker, err := verifier.NewMessageVerifier(authorizer.MessageSignatureOptions{Nonces: authorizer.NewNonceCache()})
+			Expect(err).To(BeNil())
+
+			req := signedRequest(signer, `{}`)
+			Expect(req.Header.Get(authorizer.SignatureInputHeader)).To(MatchRegexp(`^sig1=\("@method" "@authority" "@path" "@query" "content-digest"\);created=\d+;expires=\d+;nonce="[^"]+";keyid="k1";alg="ecdsa-p256-sha256"$`))
+			Expect(checker.Verify(req)).To(Succeed())
+			Expect(checker.Verify(req)).To(MatchError(authorizer.ErrReplayedNonce))
+
+			noNonce, err := verifier.NewMessageSigner(authorizer.MessageSignatureOptions{})
+			Expect(err).To(BeNil())
+			Expect(checker.Verify(signedRequest(noNonce, `{}`))).To(MatchError(authorizer.ErrInvalidMessageSignature))
+
+			expiring, err := verifier.NewMessageSigner(authorizer.MessageSignatureOptions{TTL: time.Nanosecond})
+			Expect(err).To(BeNil())
+			req = signedRequest(expiring, `{}`)
+			time.Sleep(10 * time.Millisecond)
+			plain, err := verifier.NewMessageVerifier(authorizer.MessageSignatureOptions{})
+			Expect(err).To(BeNil())
+			Expect(plain.Verify(req)).To(MatchError(authorizer.ErrExpiredMessageSignature))
+
+			pinned, err := verifier.NewMessageVerifier(authorizer.MessageSignatureOptions{KeyID: "k2"})
+			Expect(err).To(BeNil())
+			Expect(pinned.Verify(signedRequest(signer, `{}`))).To(MatchError(authorizer.ErrInvalidMessageSignature))
+
+			By("Created, expires, nonce and keyid ok")
+		})
+	})
+
+	Context("Bounded nonce cache", func() {
+		It("Prepare", func() {
+
+			nonces := authorizer.NewNonceCacheSize(2)
+			soon := time.Now().Add(50 * time.Millisecond)
+			Expect(nonces.CheckNonce("n1", soon)).To(BeTrue())
+			Expect(nonces.CheckNonce("n1", soon)).To(BeFalse())
+			Expect(nonces.CheckNonce("n2", time.Now().Add(time.Minute))).To(BeTrue())
+
+			By("full: rejected, nothing is evicted")
+			Expect(nonces.CheckNonce("n3", time.Now().Add(time.Minute))).To(BeFalse())
+			Expect(nonces.CheckNonce("n2", time.Now().Add(time.Minute))).To(BeFalse())
+
+			By("room again once the first one expires")
+			time.Sleep(100 * time.Millisecond)
+			Expect(nonces.CheckNonce("n3", time.Now().Add(time.Minute))).To(BeTrue())
+
+			By("Bounded nonce cache ok")
+		})
+	})
+
+	Context("Algorithm allowlist", func() {
+		It("Prepare", func() {
+
+			keys := authorizertest.NewRSAKeyPair(GinkgoT(), 2048)
+			signer, err := service(keys).NewMessageSigner(authorizer.MessageSignatureOptions{})
+			Expect(err).To(BeNil())
+			pss := func(req *http.Request) *http.Request {
+				input := req.Header.Get(authorizer.SignatureInputHeader)
+				req.Header.Set(authorizer.SignatureInputHeader, strings.Replace(input, `alg="rsa-v1_5-sha256"`, `alg="rsa-pss-sha512"`, 1))
+				return req
+			}
+
+			// rsa-pss-sha512 ( PS512 ) is never in an allowlist
+			allowlisted, err := authorizer.New(authorizer.WithPublicKey(keys.PublicKey), authorizer.WithTokenSource(authorizertest.DefaultTokenSource), authorizer.WithAlgorithms("RS256"))
+			Expect(err).To(BeNil())
+			checker, err := allowlisted.NewMessageVerifier(authorizer.MessageSignatureOptions{})
+			Expect(err).To(BeNil())
+			Expect(checker.Verify(signedRequest(signer, `{}`))).To(Succeed())
+			Expect(checker.Verify(pss(signedRequest(signer, `{}`)))).To(MatchError(authorizer.ErrAlgorithmNotAllowed))
+
+			// only the declared algorithm is tried
+			checker, err = service(keys).NewMessageVerifier(authorizer.MessageSignatureOptions{})
+			Expect(err).To(BeNil())
+			Expect(checker.Verify(pss(signedRequest(signer, `{}`)))).To(MatchError(authorizer.ErrInvalidMessageSignature))
+
+			// the key algorithm itself not allowed
+			allowlisted, err = authorizer.New(authorizer.WithPublicKey(keys.PublicKey), authorizer.WithTokenSource(authorizertest.DefaultTokenSource), authorizer.WithAlgorithms("RS512"))
+			Expect(err).To(BeNil())
+			_, err = allowlisted.NewMessageVerifier(authorizer.MessageSignatureOptions{})
+			Expect(err).To(MatchError(authorizer.ErrAlgorithmNotAllowed))
+
+			By("Algorithm allowlist ok")
+		})
+	})
+
+	Context("Body size limit", func() {
+		It("Prepare", func() {
+
+			verifier := service(authorizertest.NewRSAKeyPair(GinkgoT(), 2048))
+			signer, err := verifier.NewMessageSigner(authorizer.MessageSignatureOptions{})
+			Expect(err).To(BeNil())
+			checker, err := verifier.NewMessageVerifier(authorizer.MessageSignatureOptions{})
+			Expect(err).To(BeNil())
+			handler := checker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+			}))
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, signedRequest(signer, strings.Repeat("a", authorizer.DefaultMaxBodyBytes+1)))
+			Expect(w.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			var tooLarge *http.MaxBytesError
+			Expect(errors.As(checker.Verify(signedRequest(signer, strings.Repeat("a", authorizer.DefaultMaxBodyBytes+1))), &tooLarge)).To(BeTrue())
+
+			w = httptest.NewRecorder()
+			handler.ServeHTTP(w, signedRequest(signer, strings.Repeat("a", 1024)))
+			Expect(w.Code).To(Equal(http.StatusAccepted))
+
+			By("Body size limit ok")
+		})
+	})
+
+	Context("Unsupported keys", func() {
+		It("Prepare", func() {
+
+			verifier := service(authorizertest.NewECKeyPair(GinkgoT(), elliptic.P521()))
+			_, err := verifier.NewMessageSigner(authorizer.MessageSignatureOptions{})
+			Expect(err).To(MatchError(authorizer.ErrUnsupportedKey))
+			_, err = verifier.NewMessageVerifier(authorizer.MessageSignatureOptions{})
+			Expect(err).To(MatchError(authorizer.ErrUnsupportedKey))
+
+			By("Unsupported keys ok")
+		})
+	})
+})
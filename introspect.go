@@ -0,0 +1,151 @@
+package authorizer
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+var (
+	// ErrInvalidClient ...
+	ErrInvalidClient = errors.New("invalid client")
+)
+
+// ClientAuthenticator authenticate the client calling an endpoint ( ie: introspection ), the client id on success
+type ClientAuthenticator interface {
+	AuthenticateClient(r *http.Request) (string, error)
+}
+
+// ClientAuthenticatorFunc ...
+type ClientAuthenticatorFunc func(r *http.Request) (string, error)
+
+// AuthenticateClient ...
+func (f ClientAuthenticatorFunc) AuthenticateClient(r *http.Request) (string, error) {
+	return f(r)
+}
+
+// StaticClients client id -> secret, client_secret_basic or client_secret_post ( RFC 6749 2.3.1 )
+type StaticClients map[string]string
+
+// AuthenticateClient ...
+func (c StaticClients) AuthenticateClient(r *http.Request) (string, error) {
+	id, secret, ok := clientCredentials(r)
+	if !ok {
+		return "", ErrInvalidClient
+	}
+	want, known := c[id]
+	// hashed so the comparison does not leak the length
+	a, b := sha256.Sum256([]byte(secret)), sha256.Sum256([]byte(want))
+	if subtle.ConstantTimeCompare(a[:], b[:]) != 1 || !known {
+		return "", ErrInvalidClient
+	}
+	return id, nil
+}
+
+// clientCredentials basic auth or the client_id/client_secret form values
+func clientCredentials(r *http.Request) (string, string, bool) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		// form-urlencoded before the basic encoding ( RFC 6749 2.3.1 )
+		if v, err := url.QueryUnescape(id); err == nil {
+			id = v
+		}
+		if v, err := url.QueryUnescape(secret); err == nil {
+			secret = v
+		}
+		return id, secret, id != ""
+	}
+	id, secret := r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	return id, secret, id != "" && secret != ""
+}
+
+// IntrospectionResponse RFC 7662 2.2, only active is set for an inactive token
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  string   `json:"aud,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+}
+
+// Introspection RFC 7662 handler: POST token=<token> by an authenticated client.
+// The token is checked by Verify ( signature, expiry and the revocation checks ),
+// any failure is answered with {"active":false}.
+type Introspection struct {
+	verifier TokenVerifier
+	clients  ClientAuthenticator
+}
+
+// NewIntrospection the clients are required, the endpoint must not be an open token oracle
+func NewIntrospection(verifier TokenVerifier, clients ClientAuthenticator) *Introspection {
+	return &Introspection{
+		verifier: verifier,
+		clients:  clients,
+	}
+}
+
+// ServeHTTP ...
+func (i *Introspection) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if i.clients == nil {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	if _, err := i.clients.AuthenticateClient(r); err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="introspection"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// token_type_hint is optional and only access tokens are issued, it is ignored
+	resp := IntrospectionResponse{}
+	if claims, err := i.verifier.Verify(token); err == nil {
+		resp = introspect(claims)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// introspect map the verified claims to the RFC 7662 fields
+func introspect(claims *AuthClaims) IntrospectionResponse {
+	resp := IntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		TokenType: "Bearer",
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+		NotBefore: claims.NotBefore,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		ID:        claims.Id,
+	}
+	if claims.Details != nil {
+		resp.Username = claims.Details.Name
+		resp.Roles = claims.Details.Roles
+	}
+	return resp
+}
@@ -0,0 +1,131 @@
+package authorizer_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+	"github.com/bayugyug/authorizer/authorizertest"
+)
+
+var _ = Describe("Introspection", func() {
+
+	var (
+		tokens   *authorizertest.TokenFactory
+		verifier *authorizer.VerifierService
+		revoked  *authorizer.RevocationList
+		handler  http.Handler
+	)
+
+	BeforeEach(func() {
+		revoked = authorizer.NewRevocationList()
+		verifier = authorizertest.NewVerifier(GinkgoT(), authorizer.WithRevocation(revoked))
+		tokens = authorizertest.NewTokenFactory(GinkgoT(), verifier)
+		handler = authorizer.NewIntrospection(verifier, authorizer.StaticClients{"resource-server": "s3cret"})
+	})
+
+	introspect := func(token string, auth func(r *http.Request)) (*httptest.ResponseRecorder, map[string]interface{}) {
+		form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+		req := httptest.NewRequest(http.MethodPost, "/introspect", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if auth != nil {
+			auth(req)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		body := map[string]interface{}{}
+		if w.Code == http.StatusOK {
+			Expect(json.Unmarshal(w.Body.Bytes(), &body)).To(Succeed())
+		}
+		return w, body
+	}
+	basic := func(id, secret string) func(r *http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(id, secret) }
+	}
+
+	Context("Active token", func() {
+		It("Prepare", func() {
+
+			claims := tokens.Claims(authorizertest.WithSubject("user-1001"), authorizertest.WithRoles("admin"))
+			claims.Scope = "orders:read orders:write"
+			claims.Details.Name = "juan"
+			token, err := verifier.Sign(claims)
+			Expect(err).To(BeNil())
+
+			w, body := introspect(token, basic("resource-server", "s3cret"))
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Header().Get("Cache-Control")).To(Equal("no-store"))
+			Expect(body["active"]).To(BeTrue())
+			Expect(body["sub"]).To(Equal("user-1001"))
+			Expect(body["scope"]).To(Equal("orders:read orders:write"))
+			Expect(body["username"]).To(Equal("juan"))
+			Expect(body["token_type"]).To(Equal("Bearer"))
+			Expect(body).To(HaveKey("exp"))
+			Expect(body).To(HaveKey("jti"))
+
+			By("Active token ok")
+		})
+	})
+
+	Context("Inactive tokens", func() {
+		It("Prepare", func() {
+
+			for name, token := range map[string]string{
+				"expired":   tokens.Expired(),
+				"wrong key": tokens.WrongKey(),
+				"garbage":   "not-a-token",
+			} {
+				w, body := introspect(token, basic("resource-server", "s3cret"))
+				Expect(w.Code).To(Equal(http.StatusOK), name)
+				Expect(body).To(Equal(map[string]interface{}{"active": false}), name)
+			}
+
+			By("a revoked token")
+			token := tokens.Valid()
+			_, body := introspect(token, basic("resource-server", "s3cret"))
+			Expect(body["active"]).To(BeTrue())
+			revoked.Revoke(body["jti"].(string), time.Time{})
+			_, body = introspect(token, basic("resource-server", "s3cret"))
+			Expect(body).To(Equal(map[string]interface{}{"active": false}))
+
+			By("Inactive tokens ok")
+		})
+	})
+
+	Context("Client authentication", func() {
+		It("Prepare", func() {
+
+			token := tokens.Valid()
+			w, _ := introspect(token, nil)
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			Expect(w.Header().Get("WWW-Authenticate")).To(HavePrefix("Basic"))
+
+			w, _ = introspect(token, basic("resource-server", "wrong"))
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			w, _ = introspect(token, basic("unknown", "s3cret"))
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+
+			By("client_secret_post")
+			form := url.Values{"token": {token}, "client_id": {"resource-server"}, "client_secret": {"s3cret"}}
+			req := httptest.NewRequest(http.MethodPost, "/introspect", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w = httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			By("GET is not allowed")
+			w = httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/introspect?token="+token, nil))
+			Expect(w.Code).To(Equal(http.StatusMethodNotAllowed))
+
+			By("Client authentication ok")
+		})
+	})
+})
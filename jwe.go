@@ -0,0 +1,250 @@
+package authorizer
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" // RSA-OAEP is defined with SHA-1 ( RFC 7518 4.3 )
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+const (
+	// JWE algorithms ( RFC 7518 )
+	jweAlgRSAOAEP    = "RSA-OAEP"
+	jweAlgRSAOAEP256 = "RSA-OAEP-256"
+	jweAlgECDHES     = "ECDH-ES"
+	jweEncA256GCM    = "A256GCM"
+	jweCtyJWT        = "JWT"
+)
+
+var (
+	// ErrInvalidJWE ...
+	ErrInvalidJWE = errors.New("invalid encrypted token")
+	// ErrMissingDecryptionKey ...
+	ErrMissingDecryptionKey = errors.New("missing decryption key")
+)
+
+// jweHeader protected header of a compact JWE
+type jweHeader struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc"`
+	Cty string `json:"cty,omitempty"`
+	Epk *ecJWK `json:"epk,omitempty"`
+	Apu string `json:"apu,omitempty"`
+	Apv string `json:"apv,omitempty"`
+	Zip string `json:"zip,omitempty"`
+}
+
+// ecJWK ephemeral public key of ECDH-ES
+type ecJWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// isJWE compact JWE have 5 parts, JWS 3
+func isJWE(token string) bool {
+	return strings.Count(token, ".") == 4
+}
+
+// encryptJWE RSA-OAEP or ECDH-ES ( following the key ) with A256GCM
+func encryptJWE(plaintext []byte, key crypto.PublicKey, cty string) (string, error) {
+	header := jweHeader{Enc: jweEncA256GCM, Cty: cty}
+	var cek, encryptedKey []byte
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		header.Alg = jweAlgRSAOAEP
+		cek = make([]byte, 32)
+		if _, err := rand.Read(cek); err != nil {
+			return "", err
+		}
+		var err error
+		if encryptedKey, err = rsa.EncryptOAEP(sha1.New(), rand.Reader, k, cek, nil); err != nil {
+			return "", err
+		}
+	case *ecdsa.PublicKey:
+		header.Alg = jweAlgECDHES
+		recipient, err := k.ECDH()
+		if err != nil {
+			return "", err
+		}
+		ephemeral, err := recipient.Curve().GenerateKey(rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		z, err := ephemeral.ECDH(recipient)
+		if err != nil {
+			return "", err
+		}
+		point := ephemeral.PublicKey().Bytes() // 0x04 || X || Y
+		size := (len(point) - 1) / 2
+		header.Epk = &ecJWK{
+			Kty: "EC",
+			Crv: k.Curve.Params().Name,
+			X:   base64.RawURLEncoding.EncodeToString(point[1 : 1+size]),
+			Y:   base64.RawURLEncoding.EncodeToString(point[1+size:]),
+		}
+		cek = concatKDF(z, jweEncA256GCM, nil, nil)
+	default:
+		return "", ErrUnsupportedKey
+	}
+
+	raw, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(raw)
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nil, iv, plaintext, []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	enc := base64.RawURLEncoding.EncodeToString
+	return strings.Join([]string{protected, enc(encryptedKey), enc(iv), enc(ciphertext), enc(tag)}, "."), nil
+}
+
+// decryptJWE the plaintext and the protected header
+func decryptJWE(token string, key crypto.PrivateKey) ([]byte, *jweHeader, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidJWE, fmt.Sprintf(format, args...))
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, nil, invalid("expected 5 parts")
+	}
+	decoded := make([][]byte, 5)
+	for i, part := range parts {
+		var err error
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(part); err != nil {
+			return nil, nil, invalid("part %d: %v", i, err)
+		}
+	}
+	header := &jweHeader{}
+	if err := json.Unmarshal(decoded[0], header); err != nil {
+		return nil, nil, invalid("header: %v", err)
+	}
+	if header.Enc != jweEncA256GCM || header.Zip != "" {
+		return nil, nil, invalid("unsupported enc %q zip %q", header.Enc, header.Zip)
+	}
+
+	var cek []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var h hash.Hash
+		switch header.Alg {
+		case jweAlgRSAOAEP:
+			h = sha1.New()
+		case jweAlgRSAOAEP256:
+			h = sha256.New()
+		default:
+			return nil, nil, invalid("unexpected alg %q", header.Alg)
+		}
+		var err error
+		if cek, err = rsa.DecryptOAEP(h, rand.Reader, k, decoded[1], nil); err != nil {
+			return nil, nil, invalid("%v", err)
+		}
+	case *ecdsa.PrivateKey:
+		if header.Alg != jweAlgECDHES || len(decoded[1]) != 0 || header.Epk == nil {
+			return nil, nil, invalid("unexpected alg %q", header.Alg)
+		}
+		ephemeral, err := header.Epk.publicKey(k)
+		if err != nil {
+			return nil, nil, invalid("epk: %v", err)
+		}
+		recipient, err := k.ECDH()
+		if err != nil {
+			return nil, nil, err
+		}
+		z, err := recipient.ECDH(ephemeral)
+		if err != nil {
+			return nil, nil, invalid("%v", err)
+		}
+		apu, _ := base64.RawURLEncoding.DecodeString(header.Apu)
+		apv, _ := base64.RawURLEncoding.DecodeString(header.Apv)
+		cek = concatKDF(z, header.Enc, apu, apv)
+	default:
+		return nil, nil, ErrUnsupportedKey
+	}
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return nil, nil, invalid("%v", err)
+	}
+	if len(decoded[2]) != gcm.NonceSize() || len(decoded[4]) != gcm.Overhead() {
+		return nil, nil, invalid("bad iv or tag")
+	}
+	plaintext, err := gcm.Open(nil, decoded[2], append(decoded[3], decoded[4]...), []byte(parts[0]))
+	if err != nil {
+		return nil, nil, invalid("%v", err)
+	}
+	return plaintext, header, nil
+}
+
+// publicKey the epk on the curve of the recipient key, the point is validated by crypto/ecdh
+func (j *ecJWK) publicKey(recipient *ecdsa.PrivateKey) (*ecdh.PublicKey, error) {
+	if j.Kty != "EC" || j.Crv != recipient.Curve.Params().Name {
+		return nil, fmt.Errorf("unexpected curve %q", j.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(j.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(j.Y)
+	if err != nil {
+		return nil, err
+	}
+	size := (recipient.Curve.Params().BitSize + 7) / 8
+	if len(x) != size || len(y) != size {
+		return nil, errors.New("bad coordinates")
+	}
+	local, err := recipient.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	return local.Curve().NewPublicKey(append(append([]byte{4}, x...), y...))
+}
+
+// concatKDF NIST SP 800-56A single step KDF with SHA-256 for a 256 bit key ( RFC 7518 4.6.2 )
+func concatKDF(z []byte, algorithmID string, apu, apv []byte) []byte {
+	lengthPrefixed := func(b []byte) []byte {
+		out := binary.BigEndian.AppendUint32(nil, uint32(len(b)))
+		return append(out, b...)
+	}
+	h := sha256.New()
+	h.Write([]byte{0, 0, 0, 1}) // round 1 is enough for 256 bits
+	h.Write(z)
+	h.Write(lengthPrefixed([]byte(algorithmID)))
+	h.Write(lengthPrefixed(apu))
+	h.Write(lengthPrefixed(apv))
+	h.Write(binary.BigEndian.AppendUint32(nil, 256))
+	return h.Sum(nil)
+}
+
+// newGCM ...
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
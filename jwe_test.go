@@ -0,0 +1,163 @@
+package authorizer_test
+
+import (
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+	"github.com/bayugyug/authorizer/authorizertest"
+)
+
+var _ = Describe("EncryptedTokens", func() {
+
+	var (
+		signing = authorizertest.NewRSAKeyPair(GinkgoT(), 2048)
+		payload = &authorizer.AuthClaims{
+			Details:  &authorizer.Details{UUID: "user-1001", AuthToken: "secret-auth-token", RefreshToken: "secret-refresh-token"},
+			MetaInfo: map[string]interface{}{"email": "juan@example.com"},
+		}
+	)
+
+	service := func(opts ...authorizer.Option) *authorizer.VerifierService {
+		all := append([]authorizer.Option{
+			authorizer.WithKeys(signing.PrivateKey, signing.PublicKey),
+			authorizer.WithTokenSource(authorizertest.DefaultTokenSource),
+		}, opts...)
+		verifier, err := authorizer.New(all...)
+		Expect(err).To(BeNil())
+		return verifier
+	}
+
+	protectedHeader := func(token string) map[string]interface{} {
+		raw, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+		Expect(err).To(BeNil())
+		header := map[string]interface{}{}
+		Expect(json.Unmarshal(raw, &header)).To(Succeed())
+		return header
+	}
+
+	Context("Nested tokens round trip", func() {
+		It("Prepare", func() {
+
+			for name, keys := range map[string]authorizertest.KeyPair{
+				"RSA-OAEP":      authorizertest.NewRSAKeyPair(GinkgoT(), 2048),
+				"ECDH-ES P-256": authorizertest.NewECKeyPair(GinkgoT(), elliptic.P256()),
+				"ECDH-ES P-521": authorizertest.NewECKeyPair(GinkgoT(), elliptic.P521()),
+			} {
+				verifier := service(authorizer.WithEncryption(keys.PublicKey, keys.PrivateKey))
+				token, err := verifier.Sign(payload)
+				Expect(err).To(BeNil(), name)
+				Expect(strings.Count(token, ".")).To(Equal(4), name)
+
+				header := protectedHeader(token)
+				Expect(header["alg"]).To(Equal(strings.Fields(name)[0]), name)
+				Expect(header["enc"]).To(Equal("A256GCM"), name)
+				Expect(header["cty"]).To(Equal("JWT"), name)
+				for _, part := range strings.Split(token, ".") {
+					raw, _ := base64.RawURLEncoding.DecodeString(part)
+					Expect(string(raw)).NotTo(ContainSubstring("secret-auth-token"), name)
+				}
+
+				claims, err := verifier.Verify(token)
+				Expect(err).To(BeNil(), name)
+				Expect(claims.Details.AuthToken).To(Equal("secret-auth-token"), name)
+				Expect(claims.MetaInfo).To(HaveKeyWithValue("email", "juan@example.com"), name)
+			}
+
+			By("Nested tokens round trip ok")
+		})
+	})
+
+	Context("Encryption keys apart from the signing keys", func() {
+		It("Prepare", func() {
+
+			recipient := authorizertest.NewECKeyPair(GinkgoT(), elliptic.P384())
+			issuer := service(authorizer.WithEncryption(recipient.PublicKey, ""))
+			token, err := issuer.Sign(payload)
+			Expect(err).To(BeNil())
+
+			// signing keys only
+			_, err = service().Verify(token)
+			Expect(err).To(MatchError(authorizer.ErrMissingDecryptionKey))
+
+			// another decryption key
+			other := authorizertest.NewECKeyPair(GinkgoT(), elliptic.P384())
+			_, err = service(authorizer.WithEncryption("", other.PrivateKey)).Verify(token)
+			Expect(err).To(MatchError(authorizer.ErrInvalidJWE))
+
+			consumer := service(authorizer.WithEncryption("", recipient.PrivateKey))
+			claims, err := consumer.Verify(token)
+			Expect(err).To(BeNil())
+			Expect(claims.Details.UUID).To(Equal("user-1001"))
+
+			// plain signed tokens still verify
+			plain, err := service().Sign(payload)
+			Expect(err).To(BeNil())
+			_, err = consumer.Verify(plain)
+			Expect(err).To(BeNil())
+
+			By("Encryption keys apart from the signing keys ok")
+		})
+	})
+
+	Context("Tampered and foreign nested tokens", func() {
+		It("Prepare", func() {
+
+			keys := authorizertest.NewRSAKeyPair(GinkgoT(), 2048)
+			verifier := service(authorizer.WithEncryption(keys.PublicKey, keys.PrivateKey))
+			token, err := verifier.Sign(payload)
+			Expect(err).To(BeNil())
+
+			parts := strings.Split(token, ".")
+			ciphertext, _ := base64.RawURLEncoding.DecodeString(parts[3])
+			ciphertext[0] ^= 0xff
+			parts[3] = base64.RawURLEncoding.EncodeToString(ciphertext)
+			_, err = verifier.Verify(strings.Join(parts, "."))
+			Expect(err).To(MatchError(authorizer.ErrInvalidJWE))
+
+			// encrypted for us but signed by someone else
+			forger := authorizertest.NewRSAKeyPair(GinkgoT(), 2048)
+			forged, err := authorizer.New(
+				authorizer.WithKeys(forger.PrivateKey, forger.PublicKey),
+				authorizer.WithTokenSource(authorizertest.DefaultTokenSource),
+				authorizer.WithEncryption(keys.PublicKey, ""),
+			)
+			Expect(err).To(BeNil())
+			token, err = forged.Sign(payload)
+			Expect(err).To(BeNil())
+			_, err = verifier.Verify(token)
+			Expect(err).To(HaveOccurred())
+
+			By("Tampered and foreign nested tokens ok")
+		})
+	})
+
+	Context("Config", func() {
+		It("Prepare", func() {
+
+			keys := authorizertest.NewRSAKeyPair(GinkgoT(), 2048)
+			cfg, err := authorizer.ParseConfig([]byte(`{
+				"encryption_key": "base64:`+base64.StdEncoding.EncodeToString([]byte(keys.PublicKey))+`",
+				"decryption_key": "base64:`+base64.StdEncoding.EncodeToString([]byte(keys.PrivateKey))+`"
+			}`), "json")
+			Expect(err).To(BeNil())
+			opts, err := cfg.Options()
+			Expect(err).To(BeNil())
+			Expect(opts.EncryptionKey).To(Equal(keys.PublicKey))
+			Expect(opts.DecryptionKey).To(Equal(keys.PrivateKey))
+
+			_, err = authorizer.New(authorizer.WithKeys(signing.PrivateKey, signing.PublicKey),
+				authorizer.WithTokenSource(authorizertest.DefaultTokenSource),
+				authorizer.WithEncryption("not a key", "not a key"))
+			Expect(err).To(MatchError(ContainSubstring("encryption key")))
+			Expect(err).To(MatchError(ContainSubstring("decryption key")))
+
+			By("Config ok")
+		})
+	})
+})
@@ -0,0 +1,122 @@
+package authorizer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+)
+
+const (
+	// JWKSPath conventional path of the key set
+	JWKSPath = "/.well-known/jwks.json"
+)
+
+// JSONWebKey public signing key ( RFC 7517 )
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet ...
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// newJSONWebKey the kid is the RFC 7638 thumbprint of the key
+func newJSONWebKey(key crypto.PublicKey) (*JSONWebKey, error) {
+	enc := base64.RawURLEncoding.EncodeToString
+	var jwk JSONWebKey
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		jwk = JSONWebKey{
+			Kty: "RSA",
+			Alg: "RS256",
+			N:   enc(k.N.Bytes()),
+			E:   enc(big.NewInt(int64(k.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk = JSONWebKey{
+			Kty: "EC",
+			Crv: k.Curve.Params().Name,
+			X:   enc(k.X.FillBytes(make([]byte, size))),
+			Y:   enc(k.Y.FillBytes(make([]byte, size))),
+		}
+		switch size {
+		case 32:
+			jwk.Alg = "ES256"
+		case 48:
+			jwk.Alg = "ES384"
+		case 66:
+			jwk.Alg = "ES512"
+		default:
+			return nil, ErrUnsupportedKey
+		}
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	jwk.Use = "sig"
+	jwk.Kid = jwk.thumbprint()
+	return &jwk, nil
+}
+
+// thumbprint sha256 of the required members in lexicographic order ( RFC 7638 3.2 )
+func (k *JSONWebKey) thumbprint() string {
+	var required interface{}
+	switch k.Kty {
+	case "RSA":
+		required = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.Kty, k.N}
+	default:
+		required = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Crv, k.Kty, k.X, k.Y}
+	}
+	raw, _ := json.Marshal(required)
+	sum := sha256.Sum256(raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JWKS the key set of the service public key
+func (s *TypedVerifierService[T]) JWKS() (*JSONWebKeySet, error) {
+	if s.publicErr != nil {
+		return nil, s.publicErr
+	}
+	jwk, err := newJSONWebKey(s.publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONWebKeySet{Keys: []JSONWebKey{*jwk}}, nil
+}
+
+// JWKSHandler serve the key set, cacheable for an hour
+func (s *TypedVerifierService[T]) JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		set, err := s.JWKS()
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		_ = json.NewEncoder(w).Encode(set)
+	})
+}
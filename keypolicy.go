@@ -0,0 +1,116 @@
+package authorizer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// DefaultMinRSABits smallest RSA modulus accepted when Options.MinRSABits is zero
+	DefaultMinRSABits = 2048
+)
+
+var (
+	// ErrAlgorithmNotAllowed ...
+	ErrAlgorithmNotAllowed = errors.New("signing algorithm not allowed")
+	// ErrKeyPolicy ...
+	ErrKeyPolicy = errors.New("key not allowed by the key policy")
+	// ErrKeyHeader ...
+	ErrKeyHeader = errors.New("token carries a key header")
+)
+
+// supportedAlgorithms the only values of Options.Algorithms, none and HMAC are never accepted
+var supportedAlgorithms = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+
+// keyHeaders headers pointing at or embedding a key ( RFC 7515 4.1 ), the key is never taken from them
+var keyHeaders = []string{"jku", "jwk", "x5u", "x5c"}
+
+// policyHolder a service whose policy also applies to the other tokens it checks, ie: client assertions
+type policyHolder interface {
+	policy() *Options
+}
+
+// policy ...
+func (s *TypedVerifierService[T]) policy() *Options {
+	return s.opts
+}
+
+// checkAlgorithms ...
+func checkAlgorithms(algs []string) error {
+	for _, alg := range algs {
+		if !anyEqual(supportedAlgorithms, []string{alg}) {
+			return fmt.Errorf("%w: %s", ErrAlgorithmNotAllowed, alg)
+		}
+	}
+	return nil
+}
+
+// checkKeyPolicy the RSA modulus size and the EC curve ( when set ) of a public or private key
+func (o *Options) checkKeyPolicy(key interface{}) error {
+	minBits := o.MinRSABits
+	if minBits == 0 {
+		minBits = DefaultMinRSABits
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return o.checkKeyPolicy(&k.PublicKey)
+	case *ecdsa.PrivateKey:
+		return o.checkKeyPolicy(&k.PublicKey)
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minBits {
+			return fmt.Errorf("%w: rsa %d bits, %d required", ErrKeyPolicy, k.N.BitLen(), minBits)
+		}
+	case *ecdsa.PublicKey:
+		curve := k.Curve.Params().Name
+		if len(o.ECCurves) > 0 && !anyEqual(o.ECCurves, []string{curve}) {
+			return fmt.Errorf("%w: curve %s", ErrKeyPolicy, curve)
+		}
+	}
+	return nil
+}
+
+// checkSigningMethod the alg of the private key must be allowed, the service would reject its own tokens
+func (o *Options) checkSigningMethod(method jwt.SigningMethod) error {
+	if len(o.Algorithms) > 0 && !anyEqual(o.Algorithms, []string{method.Alg()}) {
+		return fmt.Errorf("%w: signing with %s", ErrAlgorithmNotAllowed, method.Alg())
+	}
+	return nil
+}
+
+// checkSigningKey the key policy and the alg of a private key
+func (o *Options) checkSigningKey(key crypto.PrivateKey) error {
+	if err := o.checkKeyPolicy(key); err != nil {
+		return err
+	}
+	method, err := signingMethod(key)
+	if err != nil {
+		return err
+	}
+	return o.checkSigningMethod(method)
+}
+
+// checkTokenHeader alg none is always rejected, the alg must be allowed and,
+// with RejectKeyHeaders, the key headers must be absent
+func (o *Options) checkTokenHeader(token *jwt.Token) error {
+	alg, _ := token.Header["alg"].(string)
+	if strings.EqualFold(alg, "none") {
+		return fmt.Errorf("%w: none", ErrAlgorithmNotAllowed)
+	}
+	if len(o.Algorithms) > 0 && !anyEqual(o.Algorithms, []string{alg}) {
+		return fmt.Errorf("%w: %s", ErrAlgorithmNotAllowed, alg)
+	}
+	if o.RejectKeyHeaders {
+		for _, name := range keyHeaders {
+			if _, ok := token.Header[name]; ok {
+				return fmt.Errorf("%w: %s", ErrKeyHeader, name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package authorizer_test
+
+import (
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+	"github.com/bayugyug/authorizer/authorizertest"
+)
+
+var _ = Describe("Key policy", func() {
+
+	var (
+		rsaKeys  = authorizertest.NewRSAKeyPair(GinkgoT(), 2048)
+		weakKeys = authorizertest.NewRSAKeyPair(GinkgoT(), 1024)
+		p384Keys = authorizertest.NewECKeyPair(GinkgoT(), elliptic.P384())
+	)
+
+	newService := func(keys authorizertest.KeyPair, opts ...authorizer.Option) (*authorizer.VerifierService, error) {
+		return authorizer.New(append([]authorizer.Option{
+			authorizer.WithKeys(keys.PrivateKey, keys.PublicKey),
+			authorizer.WithTokenSource(authorizertest.DefaultTokenSource),
+		}, opts...)...)
+	}
+	// signed by hand, with any alg and headers
+	sign := func(keys authorizertest.KeyPair, method jwt.SigningMethod, headers map[string]interface{}) string {
+		token := jwt.NewWithClaims(method, &authorizer.AuthClaims{
+			StandardClaims: jwt.StandardClaims{
+				Subject:   "user-1001",
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			},
+		})
+		for name, value := range headers {
+			token.Header[name] = value
+		}
+		var key interface{} = jwt.UnsafeAllowNoneSignatureType
+		if method != jwt.SigningMethodNone {
+			privateKey, err := authorizer.ParsePrivateKey(keys.PrivateKey)
+			Expect(err).To(BeNil())
+			key = privateKey
+		}
+		tokenStr, err := token.SignedString(key)
+		Expect(err).To(BeNil())
+		return tokenStr
+	}
+
+	Context("Weak keys", func() {
+		It("Prepare", func() {
+
+			_, err := newService(weakKeys, authorizer.WithKeyPolicy(2048))
+			Expect(errors.Is(err, authorizer.ErrKeyPolicy)).To(BeTrue())
+
+			// DefaultMinRSABits unless a lower one is set explicitly
+			_, err = newService(weakKeys)
+			Expect(errors.Is(err, authorizer.ErrKeyPolicy)).To(BeTrue())
+			_, err = authorizer.New(authorizer.WithPublicKey(weakKeys.PublicKey), authorizer.WithTokenSource(authorizertest.DefaultTokenSource))
+			Expect(errors.Is(err, authorizer.ErrKeyPolicy)).To(BeTrue())
+			_, err = newService(weakKeys, authorizer.WithKeyPolicy(1024))
+			Expect(err).To(BeNil())
+			_, err = newService(rsaKeys)
+			Expect(err).To(BeNil())
+
+			_, err = newService(rsaKeys, authorizer.WithKeyPolicy(3072))
+			Expect(errors.Is(err, authorizer.ErrKeyPolicy)).To(BeTrue())
+
+			By("Weak keys ok")
+		})
+	})
+
+	Context("EC curves", func() {
+		It("Prepare", func() {
+
+			_, err := newService(p384Keys, authorizer.WithKeyPolicy(0, "P-256"))
+			Expect(errors.Is(err, authorizer.ErrKeyPolicy)).To(BeTrue())
+
+			service, err := newService(p384Keys, authorizer.WithKeyPolicy(0, "P-256", "P-384"))
+			Expect(err).To(BeNil())
+			_, err = service.Verify(sign(p384Keys, jwt.SigningMethodES384, nil))
+			Expect(err).To(BeNil())
+
+			By("EC curves ok")
+		})
+	})
+
+	Context("Algorithm allowlist", func() {
+		It("Prepare", func() {
+
+			_, err := newService(rsaKeys, authorizer.WithAlgorithms("RS256", "HS256"))
+			Expect(errors.Is(err, authorizer.ErrAlgorithmNotAllowed)).To(BeTrue())
+			_, err = newService(rsaKeys, authorizer.WithAlgorithms("none"))
+			Expect(errors.Is(err, authorizer.ErrAlgorithmNotAllowed)).To(BeTrue())
+
+			// the service must accept what it signs ( RS256 with an RSA key )
+			_, err = newService(rsaKeys, authorizer.WithAlgorithms("RS512"))
+			Expect(errors.Is(err, authorizer.ErrAlgorithmNotAllowed)).To(BeTrue())
+			_, err = authorizer.New(
+				authorizer.WithPublicKey(rsaKeys.PublicKey),
+				authorizer.WithTokenSource(authorizertest.DefaultTokenSource),
+				authorizer.WithAlgorithms("RS512"),
+			)
+			Expect(err).To(BeNil())
+
+			service, err := newService(rsaKeys, authorizer.WithAlgorithms("RS256"))
+			Expect(err).To(BeNil())
+			_, err = service.Verify(sign(rsaKeys, jwt.SigningMethodRS256, nil))
+			Expect(err).To(BeNil())
+			_, err = service.Verify(sign(rsaKeys, jwt.SigningMethodRS512, nil))
+			Expect(errors.Is(err, authorizer.ErrAlgorithmNotAllowed)).To(BeTrue())
+
+			// without an allowlist any alg of the key type
+			service, err = newService(rsaKeys)
+			Expect(err).To(BeNil())
+			_, err = service.Verify(sign(rsaKeys, jwt.SigningMethodRS512, nil))
+			Expect(err).To(BeNil())
+
+			By("Algorithm allowlist ok")
+		})
+	})
+
+	Context("Alg none", func() {
+		It("Prepare", func() {
+
+			service, err := newService(rsaKeys)
+			Expect(err).To(BeNil())
+			_, err = service.Verify(sign(rsaKeys, jwt.SigningMethodNone, nil))
+			Expect(errors.Is(err, authorizer.ErrAlgorithmNotAllowed)).To(BeTrue())
+
+			// nor any other case of it
+			_, err = service.Verify(sign(rsaKeys, jwt.SigningMethodRS256, map[string]interface{}{"alg": "NoNe"}))
+			Expect(err).NotTo(BeNil())
+
+			By("Alg none ok")
+		})
+	})
+
+	Context("Key headers", func() {
+		It("Prepare", func() {
+
+			attacker := authorizertest.NewRSAKeyPair(GinkgoT(), 2048)
+			headers := []map[string]interface{}{
+				{"jku": "https://attacker.example.com/jwks.json"},
+				{"x5u": "https://attacker.example.com/cert.pem"},
+				{"jwk": map[string]interface{}{"kty": "RSA", "n": "AQAB", "e": "AQAB"}},
+				{"x5c": []string{"MIIB"}},
+			}
+
+			// ignored: the key is never taken from the token
+			service, err := newService(rsaKeys)
+			Expect(err).To(BeNil())
+			for _, header := range headers {
+				_, err = service.Verify(sign(rsaKeys, jwt.SigningMethodRS256, header))
+				Expect(err).To(BeNil())
+				_, err = service.Verify(sign(attacker, jwt.SigningMethodRS256, header))
+				Expect(err).NotTo(BeNil())
+			}
+
+			// rejected
+			service, err = newService(rsaKeys, authorizer.WithRejectKeyHeaders(true))
+			Expect(err).To(BeNil())
+			for _, header := range headers {
+				_, err = service.Verify(sign(rsaKeys, jwt.SigningMethodRS256, header))
+				Expect(errors.Is(err, authorizer.ErrKeyHeader)).To(BeTrue())
+			}
+			_, err = service.Verify(sign(rsaKeys, jwt.SigningMethodRS256, nil))
+			Expect(err).To(BeNil())
+
+			By("Key headers ok")
+		})
+	})
+
+	Context("Key headers of detached signatures", func() {
+		It("Prepare", func() {
+
+			payload := []byte(`{"event":"order.created"}`)
+			// a detached JWS with a jku, signed by hand
+			raw, err := json.Marshal(map[string]interface{}{"alg": "RS256", "typ": "detached+jws", "jku": "https://attacker.example.com/jwks.json"})
+			Expect(err).To(BeNil())
+			header := base64.RawURLEncoding.EncodeToString(raw)
+			privateKey, err := authorizer.ParsePrivateKey(rsaKeys.PrivateKey)
+			Expect(err).To(BeNil())
+			sig, err := jwt.SigningMethodRS256.Sign(header+"."+base64.RawURLEncoding.EncodeToString(payload), privateKey)
+			Expect(err).To(BeNil())
+			jws := header + ".." + sig
+
+			service, err := newService(rsaKeys)
+			Expect(err).To(BeNil())
+			Expect(service.VerifyBytes(jws, payload)).To(Succeed())
+
+			service, err = newService(rsaKeys, authorizer.WithRejectKeyHeaders(true))
+			Expect(err).To(BeNil())
+			Expect(errors.Is(service.VerifyBytes(jws, payload), authorizer.ErrKeyHeader)).To(BeTrue())
+
+			jws, err = service.SignBytes(payload)
+			Expect(err).To(BeNil())
+			Expect(service.VerifyBytes(jws, payload)).To(Succeed())
+
+			By("Key headers of detached signatures ok")
+		})
+	})
+
+	Context("Config", func() {
+		It("Prepare", func() {
+
+			cfg, err := authorizer.ParseConfig([]byte(`
+algorithms: [ES256]
+min_rsa_bits: 3072
+ec_curves: [P-256]
+reject_key_headers: true
+`), "yaml")
+			Expect(err).To(BeNil())
+			opts, err := cfg.Options()
+			Expect(err).To(BeNil())
+			Expect(opts.Algorithms).To(Equal([]string{"ES256"}))
+			Expect(opts.MinRSABits).To(Equal(3072))
+			Expect(opts.ECCurves).To(Equal([]string{"P-256"}))
+			Expect(opts.RejectKeyHeaders).To(BeTrue())
+
+			By("Config ok")
+		})
+	})
+})
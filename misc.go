@@ -1,25 +1,61 @@
 package authorizer
 
 import (
+	"container/heap"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/bayugyug/commons"
 )
 
+// Extractor pull a raw token out of the request, empty if not found
+type Extractor func(r *http.Request) string
+
+// FromAuthBearer ...
+func FromAuthBearer() Extractor {
+	return GetTokenFromAuthBearer
+}
+
+// FromHeader ...
+func FromHeader(key string) Extractor {
+	return func(r *http.Request) string {
+		return GetTokenFromHeader(r, key)
+	}
+}
+
+// FromQuery ...
+func FromQuery(key string) Extractor {
+	return func(r *http.Request) string {
+		return GetTokenFromQuery(r, key)
+	}
+}
+
+// FromCookie ...
+func FromCookie(name string) Extractor {
+	return func(r *http.Request) string {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(cookie.Value)
+	}
+}
+
 // GetPublicKey ...
 func GetPublicKey(key string) func(token *jwt.Token) (interface{}, error) {
 	return func(token *jwt.Token) (interface{}, error) {
 		// parse the key
-		block, _ := pem.Decode([]byte(key))
-		if block == nil {
-			return nil, errors.New("failed to parse PEM block containing the public key")
-		}
-		pub, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		pub, err := ParseRSAPublicKey(key)
 		if err != nil {
 			return nil, err
 		}
@@ -33,10 +69,84 @@ func GetPublicKey(key string) func(token *jwt.Token) (interface{}, error) {
 	}
 }
 
+// ParseRSAPublicKey parse a PKCS1 or PKIX pem encoded public key
+func ParseRSAPublicKey(key string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(key))
+	if block == nil {
+		return nil, errors.New("failed to parse PEM block containing the public key")
+	}
+	if pub, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return pub, nil
+	}
+	return jwt.ParseRSAPublicKeyFromPEM([]byte(key))
+}
+
+// ParseRSAPrivateKey parse a PKCS1 or PKCS8 pem encoded private key
+func ParseRSAPrivateKey(key string) (*rsa.PrivateKey, error) {
+	return jwt.ParseRSAPrivateKeyFromPEM([]byte(key))
+}
+
+// ParsePublicKey parse a pem encoded RSA or ECDSA public key
+func ParsePublicKey(key string) (crypto.PublicKey, error) {
+	pub, err := ParseRSAPublicKey(key)
+	if err == nil {
+		return pub, nil
+	}
+	if ecPub, ecErr := jwt.ParseECPublicKeyFromPEM([]byte(key)); ecErr == nil {
+		return ecPub, nil
+	}
+	return nil, err
+}
+
+// ParsePrivateKey parse a pem encoded RSA or ECDSA private key
+func ParsePrivateKey(key string) (crypto.PrivateKey, error) {
+	priv, err := ParseRSAPrivateKey(key)
+	if err == nil {
+		return priv, nil
+	}
+	if ecPriv, ecErr := jwt.ParseECPrivateKeyFromPEM([]byte(key)); ecErr == nil {
+		return ecPriv, nil
+	}
+	return nil, err
+}
+
+// signingMethod RS256 for RSA keys, ES256/ES384/ES512 following the ECDSA curve
+func signingMethod(key crypto.PrivateKey) (jwt.SigningMethod, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PrivateKey:
+		switch k.Curve.Params().BitSize {
+		case 256:
+			return jwt.SigningMethodES256, nil
+		case 384:
+			return jwt.SigningMethodES384, nil
+		case 521:
+			return jwt.SigningMethodES512, nil
+		}
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// publicKeyOf ...
+func publicKeyOf(key crypto.PrivateKey) crypto.PublicKey {
+	if signer, ok := key.(crypto.Signer); ok {
+		return signer.Public()
+	}
+	return nil
+}
+
+// sameKey ...
+func sameKey(a, b crypto.PublicKey) bool {
+	k, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(b)
+}
+
 // GetTokenFromAuthBearer ...
 func GetTokenFromAuthBearer(r *http.Request) string {
 	bearer := r.Header.Get("Authorization")
-	if len(bearer) > 7 && strings.ToUpper(bearer[0:6]) == "BEARER" {
+	// the scheme must be followed by a space ( "Bearerxyz" is not a bearer token )
+	if len(bearer) > 7 && strings.EqualFold(bearer[0:7], "bearer ") {
 		return strings.TrimSpace(bearer[7:])
 	}
 	return ""
@@ -51,3 +161,69 @@ func GetTokenFromHeader(r *http.Request, key string) string {
 func GetTokenFromQuery(r *http.Request, key string) string {
 	return strings.TrimSpace(r.URL.Query().Get(key))
 }
+
+// tokenFinder the token UnSign would verify, for the handlers that must strip it
+type tokenFinder interface {
+	findToken(r *http.Request) string
+}
+
+// firstToken ...
+func firstToken(r *http.Request, extractors []Extractor) string {
+	for _, extract := range extractors {
+		if token := extract(r); token != "" {
+			return token
+		}
+	}
+	return ""
+}
+
+// extractors the token sources in the order they are tried
+func (o *Options) extractors() []Extractor {
+	var list []Extractor
+	if o.TokenSource.AuthBearer {
+		list = append(list, FromAuthBearer())
+	}
+	if o.TokenSource.HeaderKey != "" {
+		list = append(list, FromHeader(o.TokenSource.HeaderKey))
+	}
+	if o.TokenSource.QueryKey != "" {
+		list = append(list, FromQuery(o.TokenSource.QueryKey))
+	}
+	return append(list, o.Extractors...)
+}
+
+// formatKey undo the escaped new lines of keys coming from the envt
+func formatKey(key string) string {
+	return commons.FormatConfigFromEnvt(key)
+}
+
+// expiryEntry a nonce or a token id and when it can be forgotten
+type expiryEntry struct {
+	key   string
+	until time.Time
+}
+
+// expiryHeap the entries by expiry, the first to expire on top ( container/heap )
+type expiryHeap []expiryEntry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].until.Before(h[j].until) }
+func (h expiryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+// Push ...
+func (h *expiryHeap) Push(x interface{}) { *h = append(*h, x.(expiryEntry)) }
+
+// Pop ...
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// popExpired the entries expired at now, top first
+func (h *expiryHeap) popExpired(now time.Time, drop func(entry expiryEntry)) {
+	for h.Len() > 0 && now.After((*h)[0].until) {
+		drop(heap.Pop(h).(expiryEntry))
+	}
+}
@@ -36,25 +36,30 @@ func (m *MockVerifierServiceCreator) EXPECT() *MockVerifierServiceCreatorMockRec
 }
 
 // Sign mocks base method.
-func (m *MockVerifierServiceCreator) Sign(arg0 *authorizer.AuthClaims) (string, error) {
+func (m *MockVerifierServiceCreator) Sign(arg0 *authorizer.Claims[interface{}], arg1 ...authorizer.SignOptions) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Sign", arg0)
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Sign", varargs...)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Sign indicates an expected call of Sign.
-func (mr *MockVerifierServiceCreatorMockRecorder) Sign(arg0 interface{}) *gomock.Call {
+func (mr *MockVerifierServiceCreatorMockRecorder) Sign(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Sign", reflect.TypeOf((*MockVerifierServiceCreator)(nil).Sign), arg0)
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Sign", reflect.TypeOf((*MockVerifierServiceCreator)(nil).Sign), varargs...)
 }
 
 // UnSign mocks base method.
-func (m *MockVerifierServiceCreator) UnSign(arg0 *http.Request) (*authorizer.AuthClaims, error) {
+func (m *MockVerifierServiceCreator) UnSign(arg0 *http.Request) (*authorizer.Claims[interface{}], error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "UnSign", arg0)
-	ret0, _ := ret[0].(*authorizer.AuthClaims)
+	ret0, _ := ret[0].(*authorizer.Claims[interface{}])
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
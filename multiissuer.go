@@ -0,0 +1,192 @@
+package authorizer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	// ErrUnknownIssuer ...
+	ErrUnknownIssuer = errors.New("unknown token issuer")
+	// ErrInvalidAudience ...
+	ErrInvalidAudience = errors.New("token audience not accepted")
+	// ErrInvalidIssuerConfig ...
+	ErrInvalidIssuerConfig = errors.New("invalid issuer config")
+)
+
+// IssuerConfig a trusted issuer of a MultiVerifier
+type IssuerConfig struct {
+	Issuer     string   // iss of its tokens, required
+	Tenant     string   // value of the TenantClaim routed to this issuer, required when routing by tenant
+	Audiences  []string // accepted aud, any when empty
+	Algorithms []string // accepted alg ( WithAlgorithms on top of its Options ), any that fits its key when empty
+	Options    []Option // its keys, token sources, cache, revocation ... as for New, no decryption key
+}
+
+// MultiVerifierConfig ...
+type MultiVerifierConfig struct {
+	Issuers []IssuerConfig
+	// TenantClaim route by this claim ( a ClaimValues name, ie: meta_info.tenant ) instead of the iss
+	TenantClaim string
+}
+
+// MultiVerifier verify the tokens of several issuers ( or tenants ), each with its own service.
+// The token is routed by its unverified iss/tenant claim, then verified by that issuer only:
+// a token can't pick the key it is checked with, and the issuers not configured are rejected.
+type MultiVerifier struct {
+	issuers       []*trustedIssuer // in config order, for UnSign
+	routes        map[string]*trustedIssuer
+	tenantClaim   string
+	maxTokenBytes int // the largest MaxTokenBytes of the issuers, no limit when negative
+}
+
+// trustedIssuer ...
+type trustedIssuer struct {
+	cfg     IssuerConfig
+	service *VerifierService
+}
+
+// NewMultiVerifier ...
+func NewMultiVerifier(cfg MultiVerifierConfig) (*MultiVerifier, error) {
+	m := &MultiVerifier{
+		routes:      make(map[string]*trustedIssuer),
+		tenantClaim: cfg.TenantClaim,
+	}
+	for _, ic := range cfg.Issuers {
+		route := ic.Issuer
+		if cfg.TenantClaim != "" {
+			route = ic.Tenant
+		}
+		switch {
+		case ic.Issuer == "" || route == "":
+			return nil, fmt.Errorf("%w: missing issuer or tenant", ErrInvalidIssuerConfig)
+		case m.routes[route] != nil:
+			return nil, fmt.Errorf("%w: duplicate %s", ErrInvalidIssuerConfig, route)
+		}
+		opts := ic.Options
+		if len(ic.Algorithms) > 0 {
+			opts = append(append([]Option(nil), opts...), WithAlgorithms(ic.Algorithms...))
+		}
+		service, err := New(opts...)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidIssuerConfig, route, err)
+		}
+		// an encrypted token can't be routed by its claims before it is decrypted
+		if strings.TrimSpace(service.opts.DecryptionKey) != "" {
+			return nil, fmt.Errorf("%w: %s: encrypted tokens are not supported", ErrInvalidIssuerConfig, route)
+		}
+		if limit := service.opts.MaxTokenBytes; m.maxTokenBytes >= 0 && (limit < 0 || limit > m.maxTokenBytes) {
+			m.maxTokenBytes = limit
+		}
+		trusted := &trustedIssuer{cfg: ic, service: service}
+		m.issuers = append(m.issuers, trusted)
+		m.routes[route] = trusted
+	}
+	if len(m.issuers) == 0 {
+		return nil, fmt.Errorf("%w: no issuers", ErrInvalidIssuerConfig)
+	}
+	return m, nil
+}
+
+// Sign a MultiVerifier only verifies
+func (m *MultiVerifier) Sign(_ *AuthClaims, _ ...SignOptions) (string, error) {
+	return "", ErrMissingPrivateKey
+}
+
+// UnSign the first token found by the token sources of an issuer that routes to that same issuer
+func (m *MultiVerifier) UnSign(req *http.Request) (*AuthClaims, error) {
+	err := ErrEmptyToken
+	for _, trusted := range m.issuers {
+		for _, extract := range trusted.service.extractors {
+			tokenStr := extract(req)
+			if tokenStr == "" {
+				continue
+			}
+			routed, routeErr := m.route(tokenStr)
+			if routeErr != nil {
+				err = routeErr
+				continue
+			}
+			if routed == trusted {
+				return m.verify(trusted, tokenStr)
+			}
+			err = ErrUnknownIssuer
+		}
+	}
+	return nil, err
+}
+
+// findToken the first token of the issuers token sources, in config order
+func (m *MultiVerifier) findToken(req *http.Request) string {
+	for _, trusted := range m.issuers {
+		if token := firstToken(req, trusted.service.extractors); token != "" {
+			return token
+		}
+	}
+	return ""
+}
+
+// Verify ...
+func (m *MultiVerifier) Verify(tokenStr string) (*AuthClaims, error) {
+	if tokenStr == "" {
+		return nil, ErrEmptyToken
+	}
+	trusted, err := m.route(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	return m.verify(trusted, tokenStr)
+}
+
+// VerifyBatch sequential, the issuer services have their own caches
+func (m *MultiVerifier) VerifyBatch(tokens []string) []VerifyResult[interface{}] {
+	results := make([]VerifyResult[interface{}], len(tokens))
+	for i, tokenStr := range tokens {
+		claims, err := m.Verify(tokenStr)
+		results[i] = VerifyResult[interface{}]{Claims: claims, Err: err}
+	}
+	return results
+}
+
+// route the issuer of the unverified claims
+func (m *MultiVerifier) route(tokenStr string) (*trustedIssuer, error) {
+	// nothing is parsed past the limit of every issuer
+	if m.maxTokenBytes > 0 && len(tokenStr) > m.maxTokenBytes {
+		return nil, ErrTokenTooLarge
+	}
+	unverified := &AuthClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenStr, unverified); err != nil {
+		return nil, ErrInvalidToken
+	}
+	route := unverified.Issuer
+	if m.tenantClaim != "" {
+		route = ""
+		if values := ClaimValues(unverified, m.tenantClaim); len(values) == 1 {
+			route = values[0]
+		}
+	}
+	trusted, ok := m.routes[route]
+	if !ok {
+		return nil, ErrUnknownIssuer
+	}
+	return trusted, nil
+}
+
+// verify with the issuer service, then the iss and the audiences of the issuer
+func (m *MultiVerifier) verify(trusted *trustedIssuer, tokenStr string) (*AuthClaims, error) {
+	claims, err := trusted.service.Verify(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Issuer != trusted.cfg.Issuer {
+		return nil, ErrUnknownIssuer
+	}
+	if len(trusted.cfg.Audiences) > 0 && !anyEqual(trusted.cfg.Audiences, []string{claims.Audience}) {
+		return nil, ErrInvalidAudience
+	}
+	return claims, nil
+}
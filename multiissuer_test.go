@@ -0,0 +1,198 @@
+package authorizer_test
+
+import (
+	"crypto/elliptic"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+	"github.com/bayugyug/authorizer/authorizertest"
+)
+
+var _ = Describe("MultiVerifier", func() {
+
+	const (
+		ownIssuer     = "https://auth.example.com"
+		partnerIssuer = "https://partner.example.com"
+	)
+
+	var (
+		ownKeys     = authorizertest.NewRSAKeyPair(GinkgoT(), 2048)
+		partnerKeys = authorizertest.NewECKeyPair(GinkgoT(), elliptic.P256())
+		otherKeys   = authorizertest.NewRSAKeyPair(GinkgoT(), 2048)
+	)
+
+	signer := func(keys authorizertest.KeyPair, issuer string) *authorizer.VerifierService {
+		service, err := authorizer.New(
+			authorizer.WithKeys(keys.PrivateKey, keys.PublicKey),
+			authorizer.WithTokenSource(authorizertest.DefaultTokenSource),
+			authorizer.WithIssuer(issuer),
+		)
+		Expect(err).To(BeNil())
+		return service
+	}
+	sign := func(service *authorizer.VerifierService, claims *authorizer.AuthClaims, opts ...authorizer.SignOptions) string {
+		token, err := service.Sign(claims, opts...)
+		Expect(err).To(BeNil())
+		return token
+	}
+	user := func(subject string) *authorizer.AuthClaims {
+		return &authorizer.AuthClaims{StandardClaims: jwt.StandardClaims{Subject: subject}}
+	}
+
+	newMulti := func() *authorizer.MultiVerifier {
+		multi, err := authorizer.NewMultiVerifier(authorizer.MultiVerifierConfig{
+			Issuers: []authorizer.IssuerConfig{
+				{
+					Issuer: ownIssuer,
+					Options: []authorizer.Option{
+						authorizer.WithPublicKey(ownKeys.PublicKey),
+						authorizer.WithTokenSource(authorizer.TokenSource{AuthBearer: true}),
+					},
+				},
+				{
+					Issuer:     partnerIssuer,
+					Audiences:  []string{"gateway"},
+					Algorithms: []string{"ES256"},
+					Options: []authorizer.Option{
+						authorizer.WithPublicKey(partnerKeys.PublicKey),
+						authorizer.WithTokenSource(authorizer.TokenSource{HeaderKey: "X-Partner-Token"}),
+					},
+				},
+			},
+		})
+		Expect(err).To(BeNil())
+		return multi
+	}
+
+	Context("Routed by issuer", func() {
+		It("Prepare", func() {
+
+			multi := newMulti()
+			claims, err := multi.Verify(sign(signer(ownKeys, ownIssuer), user("user-1001")))
+			Expect(err).To(BeNil())
+			Expect(claims.Issuer).To(Equal(ownIssuer))
+
+			claims, err = multi.Verify(sign(signer(partnerKeys, partnerIssuer), user("partner-7"), authorizer.SignOptions{Audience: "gateway"}))
+			Expect(err).To(BeNil())
+			Expect(claims.Subject).To(Equal("partner-7"))
+
+			By("each issuer with its own token source")
+			req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			req.Header.Set("X-Partner-Token", sign(signer(partnerKeys, partnerIssuer), user("partner-7"), authorizer.SignOptions{Audience: "gateway"}))
+			claims, err = multi.UnSign(req)
+			Expect(err).To(BeNil())
+			Expect(claims.Issuer).To(Equal(partnerIssuer))
+
+			req = httptest.NewRequest(http.MethodGet, "/orders", nil)
+			req.Header.Set("X-Partner-Token", sign(signer(ownKeys, ownIssuer), user("user-1001")))
+			_, err = multi.UnSign(req)
+			Expect(errors.Is(err, authorizer.ErrUnknownIssuer)).To(BeTrue())
+
+			By("Routed by issuer ok")
+		})
+	})
+
+	Context("Rejected tokens", func() {
+		It("Prepare", func() {
+
+			multi := newMulti()
+
+			By("an issuer not configured")
+			_, err := multi.Verify(sign(signer(otherKeys, "https://unknown.example.com"), user("x")))
+			Expect(errors.Is(err, authorizer.ErrUnknownIssuer)).To(BeTrue())
+			_, err = multi.Verify(sign(signer(otherKeys, ""), user("x")))
+			Expect(errors.Is(err, authorizer.ErrUnknownIssuer)).To(BeTrue())
+
+			By("a known issuer with another key")
+			_, err = multi.Verify(sign(signer(otherKeys, ownIssuer), user("x")))
+			Expect(err).NotTo(BeNil())
+
+			By("an algorithm or an audience not accepted by the issuer")
+			_, err = multi.Verify(sign(signer(otherKeys, partnerIssuer), user("x"), authorizer.SignOptions{Audience: "gateway"}))
+			Expect(errors.Is(err, authorizer.ErrAlgorithmNotAllowed)).To(BeTrue())
+			_, err = multi.Verify(sign(signer(partnerKeys, partnerIssuer), user("x"), authorizer.SignOptions{Audience: "billing"}))
+			Expect(errors.Is(err, authorizer.ErrInvalidAudience)).To(BeTrue())
+
+			By("a token over the size limit, before it is parsed")
+			_, err = multi.Verify(strings.Repeat("A", authorizer.DefaultMaxTokenBytes+1))
+			Expect(errors.Is(err, authorizer.ErrTokenTooLarge)).To(BeTrue())
+
+			By("Rejected tokens ok")
+		})
+	})
+
+	Context("Routed by tenant", func() {
+		It("Prepare", func() {
+
+			multi, err := authorizer.NewMultiVerifier(authorizer.MultiVerifierConfig{
+				TenantClaim: "meta_info.tenant",
+				Issuers: []authorizer.IssuerConfig{
+					{Issuer: ownIssuer, Tenant: "acme", Options: []authorizer.Option{
+						authorizer.WithPublicKey(ownKeys.PublicKey), authorizer.WithTokenSource(authorizertest.DefaultTokenSource),
+					}},
+					{Issuer: ownIssuer, Tenant: "globex", Options: []authorizer.Option{
+						authorizer.WithPublicKey(otherKeys.PublicKey), authorizer.WithTokenSource(authorizertest.DefaultTokenSource),
+					}},
+				},
+			})
+			Expect(err).To(BeNil())
+
+			tenant := func(name string) *authorizer.AuthClaims {
+				claims := user("user-1001")
+				claims.MetaInfo = map[string]interface{}{"tenant": name}
+				return claims
+			}
+			_, err = multi.Verify(sign(signer(ownKeys, ownIssuer), tenant("acme")))
+			Expect(err).To(BeNil())
+			_, err = multi.Verify(sign(signer(otherKeys, ownIssuer), tenant("globex")))
+			Expect(err).To(BeNil())
+
+			By("the key of the tenant only")
+			_, err = multi.Verify(sign(signer(ownKeys, ownIssuer), tenant("globex")))
+			Expect(err).NotTo(BeNil())
+			_, err = multi.Verify(sign(signer(ownKeys, ownIssuer), tenant("initech")))
+			Expect(errors.Is(err, authorizer.ErrUnknownIssuer)).To(BeTrue())
+
+			By("Routed by tenant ok")
+		})
+	})
+
+	Context("Invalid config", func() {
+		It("Prepare", func() {
+
+			for name, cfg := range map[string]authorizer.MultiVerifierConfig{
+				"no issuers":     {},
+				"missing iss":    {Issuers: []authorizer.IssuerConfig{{Options: []authorizer.Option{authorizer.WithPublicKey(ownKeys.PublicKey)}}}},
+				"missing tenant": {TenantClaim: "meta_info.tenant", Issuers: []authorizer.IssuerConfig{{Issuer: ownIssuer}}},
+				"bad options":    {Issuers: []authorizer.IssuerConfig{{Issuer: ownIssuer}}},
+				"duplicate": {Issuers: []authorizer.IssuerConfig{
+					{Issuer: ownIssuer, Options: []authorizer.Option{authorizer.WithPublicKey(ownKeys.PublicKey), authorizer.WithTokenSource(authorizertest.DefaultTokenSource)}},
+					{Issuer: ownIssuer, Options: []authorizer.Option{authorizer.WithPublicKey(ownKeys.PublicKey), authorizer.WithTokenSource(authorizertest.DefaultTokenSource)}},
+				}},
+			} {
+				_, err := authorizer.NewMultiVerifier(cfg)
+				Expect(errors.Is(err, authorizer.ErrInvalidIssuerConfig)).To(BeTrue(), name)
+			}
+
+			// encrypted tokens can't be routed before they are decrypted
+			_, err := authorizer.NewMultiVerifier(authorizer.MultiVerifierConfig{Issuers: []authorizer.IssuerConfig{
+				{Issuer: ownIssuer, Options: []authorizer.Option{
+					authorizer.WithPublicKey(ownKeys.PublicKey),
+					authorizer.WithTokenSource(authorizertest.DefaultTokenSource),
+					authorizer.WithEncryption("", otherKeys.PrivateKey),
+				}},
+			}})
+			Expect(errors.Is(err, authorizer.ErrInvalidIssuerConfig)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("encrypted tokens are not supported"))
+
+			By("Invalid config ok")
+		})
+	})
+})
@@ -0,0 +1,102 @@
+package authorizer_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+)
+
+var _ = Describe("New", func() {
+
+	var (
+		privKeyStr string
+		pubKeyStr  string
+	)
+
+	BeforeEach(func() {
+		privKeyStr, pubKeyStr = newKeyPair(2048)
+	})
+
+	Context("Functional options", func() {
+		It("Prepare", func() {
+
+			verifier, err := authorizer.New(
+				authorizer.WithKeys(privKeyStr, pubKeyStr),
+				authorizer.WithExpiry(90*time.Second),
+				authorizer.WithIssuer("ci-iss"),
+				authorizer.WithAudience("ci-aud"),
+				authorizer.WithExtractors(authorizer.FromCookie("_token")),
+			)
+			Expect(err).To(BeNil())
+			Expect(verifier).NotTo(BeNil())
+
+			sign, err := verifier.Sign(&authorizer.AuthClaims{})
+			Expect(err).To(BeNil())
+
+			req := httptest.NewRequest(http.MethodGet, "/get", nil)
+			req.AddCookie(&http.Cookie{Name: "_token", Value: sign})
+			res, err := verifier.UnSign(req)
+			Expect(err).To(BeNil())
+			Expect(res.Issuer).To(Equal("ci-iss"))
+			Expect(res.Audience).To(Equal("ci-aud"))
+			Expect(res.ExpiresAt - res.IssuedAt).To(BeNumerically("==", 90))
+
+			By("Functional options ok")
+		})
+	})
+
+	Context("Validation lists every misconfiguration", func() {
+		It("Prepare", func() {
+
+			verifier, err := authorizer.New(
+				authorizer.WithKeys("not-a-key", ""),
+				authorizer.WithExpiry(-time.Minute),
+			)
+			Expect(verifier).To(BeNil())
+			Expect(err).NotTo(BeNil())
+			Expect(errors.Is(err, authorizer.ErrMissingPublicKey)).To(BeTrue())
+			Expect(errors.Is(err, authorizer.ErrInvalidExpiry)).To(BeTrue())
+			Expect(errors.Is(err, authorizer.ErrMissingTokenSource)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("private key"))
+
+			By("Validation lists every misconfiguration ok")
+		})
+	})
+
+	Context("Validation key mismatch", func() {
+		It("Prepare", func() {
+
+			otherPriv, _ := newKeyPair(2048)
+			_, err := authorizer.New(
+				authorizer.WithKeys(otherPriv, pubKeyStr),
+				authorizer.WithTokenSource(authorizer.TokenSource{AuthBearer: true}),
+			)
+			Expect(errors.Is(err, authorizer.ErrKeyMismatch)).To(BeTrue())
+
+			By("Validation key mismatch ok")
+		})
+	})
+
+	Context("Verify only service", func() {
+		It("Prepare", func() {
+
+			verifier, err := authorizer.New(
+				authorizer.WithPublicKey(pubKeyStr),
+				authorizer.WithTokenSource(authorizer.TokenSource{AuthBearer: true}),
+			)
+			Expect(err).To(BeNil())
+
+			sign, err := verifier.Sign(&authorizer.AuthClaims{})
+			Expect(sign).To(BeEmpty())
+			Expect(errors.Is(err, authorizer.ErrMissingPrivateKey)).To(BeTrue())
+
+			By("Verify only service ok")
+		})
+	})
+})
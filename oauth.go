@@ -0,0 +1,428 @@
+package authorizer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// GrantTypeClientCredentials ...
+	GrantTypeClientCredentials = "client_credentials"
+	// ClientAssertionTypeJWT private_key_jwt client assertions ( RFC 7523 )
+	ClientAssertionTypeJWT = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	// DefaultClientTokenTTL lifetime of the client credentials tokens when the client has none
+	DefaultClientTokenTTL = time.Hour
+	// MaxClientAssertionLifetime longest exp - iat ( exp - now without iat ) of a client assertion,
+	// its jti is remembered that long at most
+	MaxClientAssertionLifetime = 5 * time.Minute
+
+	// secretHashPrefix HashClientSecret format: sha256$<salt>$<hash>
+	secretHashPrefix = "sha256$"
+	// oauthErrorDescriptionLimit ...
+	oauthErrorDescriptionLimit = 200
+)
+
+// OAuth2 error codes ( RFC 6749 5.2 )
+const (
+	OAuthInvalidRequest       = "invalid_request"
+	OAuthInvalidClient        = "invalid_client"
+	OAuthInvalidGrant         = "invalid_grant"
+	OAuthUnauthorizedClient   = "unauthorized_client"
+	OAuthUnsupportedGrantType = "unsupported_grant_type"
+	OAuthInvalidScope         = "invalid_scope"
+	OAuthServerError          = "server_error"
+	// authorization endpoint ( RFC 6749 4.1.2.1 )
+	OAuthAccessDenied            = "access_denied"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+)
+
+var (
+	// ErrUnknownClient ...
+	ErrUnknownClient = errors.New("unknown client")
+)
+
+// OAuthClient a registered client of the token endpoint, either SecretHash or PublicKey is set unless Public
+type OAuthClient struct {
+	ID         string
+	SecretHash string        // HashClientSecret of the secret, client_secret_basic or client_secret_post
+	PublicKey  string        // pem public key of the private_key_jwt assertions ( RFC 7523 )
+	Scopes     []string      // allowed scopes, all of them are granted when none is requested
+	Audience   string        // aud of the issued tokens, the service default when empty
+	TTL        time.Duration // lifetime of the issued tokens, DefaultClientTokenTTL when zero
+	Roles      []string      // Details.Roles of the issued tokens
+
+	// RedirectURIs exact redirect uris of the authorization code grant
+	RedirectURIs []string
+	// Public no secret nor key ( ie: a single page app ), authorization code with PKCE only
+	Public bool
+}
+
+// ClientStore lookup of the registered clients, ErrUnknownClient when not found
+type ClientStore interface {
+	Client(ctx context.Context, id string) (*OAuthClient, error)
+}
+
+// StaticClientStore in memory ClientStore keyed by client id
+type StaticClientStore map[string]*OAuthClient
+
+// Client ...
+func (s StaticClientStore) Client(_ context.Context, id string) (*OAuthClient, error) {
+	client, ok := s[id]
+	if !ok {
+		return nil, ErrUnknownClient
+	}
+	return client, nil
+}
+
+// HashClientSecret salted sha256 of a client secret for OAuthClient.SecretHash.
+// Client secrets are random and long, unlike passwords they need no slow hash.
+func HashClientSecret(secret string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return secretHashPrefix + base64.RawStdEncoding.EncodeToString(salt) + "$" + secretHash(salt, secret), nil
+}
+
+// checkSecretHash ...
+func checkSecretHash(hash, secret string) bool {
+	rest, ok := strings.CutPrefix(hash, secretHashPrefix)
+	if !ok {
+		return false
+	}
+	encodedSalt, want, ok := strings.Cut(rest, "$")
+	if !ok {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(encodedSalt)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(secretHash(salt, secret)), []byte(want)) == 1
+}
+
+// secretHash ...
+func secretHash(salt []byte, secret string) string {
+	sum := sha256.Sum256(append(append([]byte(nil), salt...), secret...))
+	return base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// OAuthError RFC 6749 5.2 error response
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	status      int
+}
+
+// Error ...
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+// oauthError 401 for invalid_client, 500 for server_error, else 400
+func oauthError(code, format string, args ...interface{}) *OAuthError {
+	status := http.StatusBadRequest
+	switch code {
+	case OAuthInvalidClient:
+		status = http.StatusUnauthorized
+	case OAuthServerError:
+		status = http.StatusInternalServerError
+	}
+	description := fmt.Sprintf(format, args...)
+	if len(description) > oauthErrorDescriptionLimit {
+		description = description[:oauthErrorDescriptionLimit]
+	}
+	return &OAuthError{Code: code, Description: description, status: status}
+}
+
+// writeOAuthError ...
+func writeOAuthError(w http.ResponseWriter, err error) {
+	var oerr *OAuthError
+	if !errors.As(err, &oerr) {
+		oerr = oauthError(OAuthServerError, "")
+	}
+	if oerr.status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+	}
+	writeNoStoreJSON(w, oerr.status, oerr)
+}
+
+// writeNoStoreJSON json responses carrying tokens must not be cached ( RFC 6749 5.1 )
+func writeNoStoreJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// TokenResponse RFC 6749 5.1
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in,omitempty"`
+	Scope       string `json:"scope,omitempty"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+// TokenEndpoint OAuth2 token endpoint of the client_credentials grant ( RFC 6749 4.4 ) and,
+// WithCodes, of the authorization_code grant ( RFC 6749 4.1 ).
+// The client credentials tokens have the client id as subject, the granted scopes in the scope claim and the client roles.
+type TokenEndpoint struct {
+	verifier VerifierServiceCreator
+	clients  ClientStore
+	url      string
+	nonces   NonceChecker
+	codes    CodeStore // nil without the authorization_code grant
+}
+
+// NewTokenEndpoint the url is the expected audience of the private_key_jwt assertions
+func NewTokenEndpoint(verifier VerifierServiceCreator, clients ClientStore, url string) *TokenEndpoint {
+	return &TokenEndpoint{
+		verifier: verifier,
+		clients:  clients,
+		url:      url,
+		nonces:   NewNonceCache(),
+	}
+}
+
+// ServeHTTP ...
+func (t *TokenEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, oauthError(OAuthInvalidRequest, "malformed form"))
+		return
+	}
+	// public clients can only redeem codes
+	grant := r.PostForm.Get("grant_type")
+	client, err := t.authenticate(r, grant == GrantTypeAuthorizationCode)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	var resp *TokenResponse
+	switch {
+	case grant == GrantTypeClientCredentials:
+		resp, err = t.clientCredentials(r, client)
+	case grant == GrantTypeAuthorizationCode && t.codes != nil:
+		resp, err = t.authorizationCode(r, client)
+	case grant == "":
+		err = oauthError(OAuthInvalidRequest, "missing grant_type")
+	default:
+		err = oauthError(OAuthUnsupportedGrantType, "%s", grant)
+	}
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	writeNoStoreJSON(w, http.StatusOK, resp)
+}
+
+// WithCodes enable the authorization_code grant with the codes of the AuthorizeEndpoint
+func (t *TokenEndpoint) WithCodes(codes CodeStore) *TokenEndpoint {
+	t.codes = codes
+	return t
+}
+
+// clientCredentials token of the client itself
+func (t *TokenEndpoint) clientCredentials(r *http.Request, client *OAuthClient) (*TokenResponse, error) {
+	scopes, err := grantScopes(client, r.PostForm.Get("scope"))
+	if err != nil {
+		return nil, err
+	}
+	claims := &AuthClaims{
+		StandardClaims: jwt.StandardClaims{Subject: client.ID},
+		Scope:          strings.Join(scopes, " "),
+	}
+	if len(client.Roles) > 0 {
+		claims.Details = &Details{Roles: client.Roles}
+	}
+	return t.issue(claims, client)
+}
+
+// issue an access token with the audience and lifetime of the client
+func (t *TokenEndpoint) issue(claims *AuthClaims, client *OAuthClient) (*TokenResponse, error) {
+	ttl := client.TTL
+	if ttl <= 0 {
+		ttl = DefaultClientTokenTTL
+	}
+	token, err := t.verifier.Sign(claims, SignOptions{Audience: client.Audience, TTL: ttl})
+	if err != nil {
+		return nil, oauthError(OAuthServerError, "")
+	}
+	return &TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(ttl / time.Second),
+		Scope:       claims.Scope,
+	}, nil
+}
+
+// AuthenticateClient the endpoint clients can call the other endpoints too, ie: NewIntrospection(verifier, endpoint)
+func (t *TokenEndpoint) AuthenticateClient(r *http.Request) (string, error) {
+	client, err := t.authenticate(r, false)
+	if err != nil {
+		return "", err
+	}
+	return client.ID, nil
+}
+
+// authenticate client_secret_basic, client_secret_post or private_key_jwt, exactly one of them.
+// Public clients send only their client_id, they are accepted when public is true.
+func (t *TokenEndpoint) authenticate(r *http.Request, public bool) (*OAuthClient, error) {
+	_, _, basic := r.BasicAuth()
+	assertion := r.PostFormValue("client_assertion")
+	post := r.PostFormValue("client_secret") != ""
+	switch {
+	case basic && (post || assertion != ""), post && assertion != "":
+		return nil, oauthError(OAuthInvalidRequest, "more than one client authentication method")
+	case assertion != "":
+		return t.authenticateAssertion(r, assertion)
+	}
+
+	id, secret, ok := clientCredentials(r)
+	if !ok && public && !basic && r.PostFormValue("client_id") != "" {
+		client, err := t.client(r.Context(), r.PostFormValue("client_id"))
+		if err != nil {
+			return nil, err
+		}
+		if !client.Public {
+			return nil, oauthError(OAuthInvalidClient, "missing client credentials")
+		}
+		return client, nil
+	}
+	if !ok {
+		return nil, oauthError(OAuthInvalidClient, "missing client credentials")
+	}
+	client, err := t.client(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if client.SecretHash == "" || !checkSecretHash(client.SecretHash, secret) {
+		return nil, oauthError(OAuthInvalidClient, "")
+	}
+	return client, nil
+}
+
+// authenticateAssertion private_key_jwt: iss and sub are the client id, aud the endpoint url,
+// exp is required within MaxClientAssertionLifetime and the jti can be used once
+func (t *TokenEndpoint) authenticateAssertion(r *http.Request, assertion string) (*OAuthClient, error) {
+	if r.PostFormValue("client_assertion_type") != ClientAssertionTypeJWT {
+		return nil, oauthError(OAuthInvalidRequest, "unsupported client_assertion_type")
+	}
+	unverified := &jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(assertion, unverified); err != nil {
+		return nil, oauthError(OAuthInvalidClient, "malformed client assertion")
+	}
+	if id := r.PostFormValue("client_id"); id != "" && id != unverified.Subject {
+		return nil, oauthError(OAuthInvalidClient, "client_id does not match the assertion")
+	}
+	client, err := t.client(r.Context(), unverified.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if client.PublicKey == "" {
+		return nil, oauthError(OAuthInvalidClient, "")
+	}
+	key, err := ParsePublicKey(formatKey(client.PublicKey))
+	if err != nil {
+		return nil, oauthError(OAuthServerError, "")
+	}
+
+	// the algorithm and key header policy of the verifier, as for its access tokens
+	policy := &Options{}
+	if holder, ok := t.verifier.(policyHolder); ok {
+		policy = holder.policy()
+	}
+	if err := policy.checkKeyPolicy(key); err != nil {
+		return nil, oauthError(OAuthInvalidClient, "client key not allowed")
+	}
+	methods := policy.Algorithms
+	if len(methods) == 0 {
+		methods = supportedAlgorithms
+	}
+
+	// registered claims, the aud of an assertion may be a list
+	claims := &jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(assertion, claims, func(token *jwt.Token) (interface{}, error) {
+		if err := policy.checkTokenHeader(token); err != nil {
+			return nil, err
+		}
+		return methodKey(token, key)
+	}, jwt.WithValidMethods(methods))
+	if err != nil || !token.Valid {
+		return nil, oauthError(OAuthInvalidClient, "invalid client assertion")
+	}
+	switch {
+	case claims.Issuer != client.ID || claims.Subject != client.ID:
+		return nil, oauthError(OAuthInvalidClient, "assertion iss and sub must be the client id")
+	case !claims.VerifyAudience(t.url, true):
+		return nil, oauthError(OAuthInvalidClient, "assertion aud must be the token endpoint")
+	case claims.ExpiresAt == nil || claims.ID == "":
+		return nil, oauthError(OAuthInvalidClient, "assertion exp and jti are required")
+	case assertionLifetime(claims) > MaxClientAssertionLifetime:
+		return nil, oauthError(OAuthInvalidClient, "assertion lifetime over %s", MaxClientAssertionLifetime)
+	}
+	// a far exp must not keep the jti in the bounded nonce cache
+	until := claims.ExpiresAt.Time
+	if limit := time.Now().Add(MaxClientAssertionLifetime); until.After(limit) {
+		until = limit
+	}
+	if !t.nonces.CheckNonce(client.ID+"\n"+claims.ID, until) {
+		return nil, oauthError(OAuthInvalidClient, "replayed client assertion")
+	}
+	return client, nil
+}
+
+// assertionLifetime exp - iat, or what is left of it without an iat
+func assertionLifetime(claims *jwt.RegisteredClaims) time.Duration {
+	if claims.IssuedAt != nil {
+		return claims.ExpiresAt.Sub(claims.IssuedAt.Time)
+	}
+	return time.Until(claims.ExpiresAt.Time)
+}
+
+// client ...
+func (t *TokenEndpoint) client(ctx context.Context, id string) (*OAuthClient, error) {
+	client, err := t.clients.Client(ctx, id)
+	switch {
+	case errors.Is(err, ErrUnknownClient), err == nil && client == nil:
+		return nil, oauthError(OAuthInvalidClient, "")
+	case err != nil:
+		return nil, oauthError(OAuthServerError, "")
+	}
+	return client, nil
+}
+
+// grantScopes the requested scopes must all be allowed, every allowed scope when none is requested
+func grantScopes(client *OAuthClient, requested string) ([]string, error) {
+	scopes := strings.Fields(requested)
+	if len(scopes) == 0 {
+		return client.Scopes, nil
+	}
+	for _, scope := range scopes {
+		if !anyEqual(client.Scopes, []string{scope}) {
+			return nil, oauthError(OAuthInvalidScope, "%s", scope)
+		}
+	}
+	return scopes, nil
+}
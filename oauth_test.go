@@ -0,0 +1,256 @@
+package authorizer_test
+
+import (
+	"crypto/elliptic"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+	"github.com/bayugyug/authorizer/authorizertest"
+)
+
+var _ = Describe("TokenEndpoint", func() {
+
+	const endpointURL = "https://auth.example.com/token"
+
+	var (
+		verifier  *authorizer.VerifierService
+		handler   *authorizer.TokenEndpoint
+		clientKey = authorizertest.NewECKeyPair(GinkgoT(), elliptic.P256())
+	)
+
+	BeforeEach(func() {
+		verifier = authorizertest.NewVerifier(GinkgoT())
+		hash, err := authorizer.HashClientSecret("billing-s3cret")
+		Expect(err).To(BeNil())
+		handler = authorizer.NewTokenEndpoint(verifier, authorizer.StaticClientStore{
+			"billing": {
+				ID:         "billing",
+				SecretHash: hash,
+				Scopes:     []string{"orders:read", "orders:write"},
+				Audience:   "orders-api",
+				TTL:        15 * time.Minute,
+				Roles:      []string{"service"},
+			},
+			"reports": {
+				ID:        "reports",
+				PublicKey: clientKey.PublicKey,
+				Scopes:    []string{"orders:read"},
+			},
+		}, endpointURL)
+	})
+
+	post := func(form url.Values, auth func(r *http.Request)) (*httptest.ResponseRecorder, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if auth != nil {
+			auth(req)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		body := map[string]interface{}{}
+		Expect(json.Unmarshal(w.Body.Bytes(), &body)).To(Succeed())
+		return w, body
+	}
+	basic := func(id, secret string) func(r *http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(id, secret) }
+	}
+	signAssertion := func(headers map[string]interface{}, mutate func(claims *jwt.RegisteredClaims)) string {
+		key, err := jwt.ParseECPrivateKeyFromPEM([]byte(clientKey.PrivateKey))
+		Expect(err).To(BeNil())
+		claims := &jwt.RegisteredClaims{
+			Issuer:    "reports",
+			Subject:   "reports",
+			Audience:  jwt.ClaimStrings{endpointURL},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			ID:        time.Now().Format(time.RFC3339Nano),
+		}
+		if mutate != nil {
+			mutate(claims)
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		for name, value := range headers {
+			token.Header[name] = value
+		}
+		signed, err := token.SignedString(key)
+		Expect(err).To(BeNil())
+		return signed
+	}
+	assertion := func(mutate func(claims *jwt.RegisteredClaims)) string {
+		return signAssertion(nil, mutate)
+	}
+
+	Context("Client secret", func() {
+		It("Prepare", func() {
+
+			w, body := post(url.Values{"grant_type": {"client_credentials"}, "scope": {"orders:read"}}, basic("billing", "billing-s3cret"))
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Header().Get("Cache-Control")).To(Equal("no-store"))
+			Expect(body["token_type"]).To(Equal("Bearer"))
+			Expect(body["expires_in"]).To(BeNumerically("==", 900))
+			Expect(body["scope"]).To(Equal("orders:read"))
+
+			claims, err := verifier.Verify(body["access_token"].(string))
+			Expect(err).To(BeNil())
+			Expect(claims.Subject).To(Equal("billing"))
+			Expect(claims.Audience).To(Equal("orders-api"))
+			Expect(claims.HasScope("orders:read")).To(BeTrue())
+			Expect(claims.HasScope("orders:write")).To(BeFalse())
+			Expect(claims.HasRole("service")).To(BeTrue())
+
+			By("every allowed scope when none is requested, client_secret_post")
+			_, body = post(url.Values{"grant_type": {"client_credentials"}, "client_id": {"billing"}, "client_secret": {"billing-s3cret"}}, nil)
+			Expect(body["scope"]).To(Equal("orders:read orders:write"))
+
+			By("Client secret ok")
+		})
+	})
+
+	Context("Private key jwt", func() {
+		It("Prepare", func() {
+
+			form := func(jwt string) url.Values {
+				return url.Values{
+					"grant_type":            {"client_credentials"},
+					"client_assertion_type": {authorizer.ClientAssertionTypeJWT},
+					"client_assertion":      {jwt},
+				}
+			}
+			signed := assertion(nil)
+			w, body := post(form(signed), nil)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			claims, err := verifier.Verify(body["access_token"].(string))
+			Expect(err).To(BeNil())
+			Expect(claims.Subject).To(Equal("reports"))
+			Expect(claims.Scope).To(Equal("orders:read"))
+
+			By("replayed, wrong audience, expired or wrong key")
+			w, body = post(form(signed), nil)
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			Expect(body["error"]).To(Equal("invalid_client"))
+
+			w, _ = post(form(assertion(func(c *jwt.RegisteredClaims) { c.Audience = jwt.ClaimStrings{"https://other"} })), nil)
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			w, _ = post(form(assertion(func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) })), nil)
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			w, _ = post(form(assertion(func(c *jwt.RegisteredClaims) { c.Issuer, c.Subject = "billing", "billing" })), nil)
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+
+			By("a lifetime over MaxClientAssertionLifetime, with or without iat")
+			far := time.Now().Add(365 * 24 * time.Hour)
+			w, body = post(form(assertion(func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(far) })), nil)
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			Expect(body["error_description"]).To(ContainSubstring("lifetime"))
+			w, _ = post(form(assertion(func(c *jwt.RegisteredClaims) {
+				c.IssuedAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(authorizer.MaxClientAssertionLifetime))
+			})), nil)
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			w, _ = post(form(assertion(func(c *jwt.RegisteredClaims) {
+				c.IssuedAt = jwt.NewNumericDate(time.Now())
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(authorizer.MaxClientAssertionLifetime))
+			})), nil)
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			By("Private key jwt ok")
+		})
+	})
+
+	Context("Private key jwt with the verifier policy", func() {
+		It("Prepare", func() {
+
+			form := func(jwt string) url.Values {
+				return url.Values{
+					"grant_type":            {"client_credentials"},
+					"client_assertion_type": {authorizer.ClientAssertionTypeJWT},
+					"client_assertion":      {jwt},
+				}
+			}
+			clients := authorizer.StaticClientStore{
+				"reports": {ID: "reports", PublicKey: clientKey.PublicKey, Scopes: []string{"orders:read"}},
+			}
+			endpoint := func(opts ...authorizer.Option) *authorizer.TokenEndpoint {
+				return authorizer.NewTokenEndpoint(authorizertest.NewVerifier(GinkgoT(), opts...), clients, endpointURL)
+			}
+
+			handler = endpoint(authorizer.WithRejectKeyHeaders(true))
+			w, _ := post(form(assertion(nil)), nil)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			w, body := post(form(signAssertion(map[string]interface{}{"jku": "https://attacker.example.com/jwks.json"}, nil)), nil)
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			Expect(body["error"]).To(Equal("invalid_client"))
+
+			By("the alg must be allowed")
+			handler = endpoint(authorizer.WithAlgorithms("RS256"))
+			w, _ = post(form(assertion(nil)), nil)
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			handler = endpoint(authorizer.WithAlgorithms("RS256", "ES256"))
+			w, _ = post(form(assertion(nil)), nil)
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			By("the client key must meet the key policy")
+			handler = endpoint(authorizer.WithKeyPolicy(0, "P-384"))
+			w, _ = post(form(assertion(nil)), nil)
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+
+			By("Private key jwt with the verifier policy ok")
+		})
+	})
+
+	Context("RFC 6749 errors", func() {
+		It("Prepare", func() {
+
+			for name, tc := range map[string]struct {
+				form   url.Values
+				auth   func(r *http.Request)
+				status int
+				code   string
+			}{
+				"wrong secret":     {url.Values{"grant_type": {"client_credentials"}}, basic("billing", "wrong"), http.StatusUnauthorized, "invalid_client"},
+				"unknown client":   {url.Values{"grant_type": {"client_credentials"}}, basic("nobody", "x"), http.StatusUnauthorized, "invalid_client"},
+				"no credentials":   {url.Values{"grant_type": {"client_credentials"}}, nil, http.StatusUnauthorized, "invalid_client"},
+				"secret of a jwt":  {url.Values{"grant_type": {"client_credentials"}}, basic("reports", "x"), http.StatusUnauthorized, "invalid_client"},
+				"missing grant":    {url.Values{}, basic("billing", "billing-s3cret"), http.StatusBadRequest, "invalid_request"},
+				"unsupported":      {url.Values{"grant_type": {"password"}}, basic("billing", "billing-s3cret"), http.StatusBadRequest, "unsupported_grant_type"},
+				"scope not there":  {url.Values{"grant_type": {"client_credentials"}, "scope": {"admin"}}, basic("billing", "billing-s3cret"), http.StatusBadRequest, "invalid_scope"},
+				"two auth methods": {url.Values{"grant_type": {"client_credentials"}, "client_secret": {"x"}}, basic("billing", "billing-s3cret"), http.StatusBadRequest, "invalid_request"},
+			} {
+				w, body := post(tc.form, tc.auth)
+				Expect(w.Code).To(Equal(tc.status), name)
+				Expect(body["error"]).To(Equal(tc.code), name)
+				if tc.status == http.StatusUnauthorized {
+					Expect(w.Header().Get("WWW-Authenticate")).NotTo(BeEmpty(), name)
+				}
+			}
+
+			By("RFC 6749 errors ok")
+		})
+	})
+
+	Context("Client store for the introspection", func() {
+		It("Prepare", func() {
+
+			_, body := post(url.Values{"grant_type": {"client_credentials"}}, basic("billing", "billing-s3cret"))
+			introspection := authorizer.NewIntrospection(verifier, handler)
+
+			form := url.Values{"token": {body["access_token"].(string)}}
+			req := httptest.NewRequest(http.MethodPost, "/introspect", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.SetBasicAuth("billing", "billing-s3cret")
+			w := httptest.NewRecorder()
+			introspection.ServeHTTP(w, req)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(ContainSubstring(`"active":true`))
+
+			By("Client store for the introspection ok")
+		})
+	})
+})
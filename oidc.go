@@ -0,0 +1,156 @@
+package authorizer
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// DiscoveryPath OpenID Connect discovery document path, under the issuer url
+	DiscoveryPath = "/.well-known/openid-configuration"
+	// idTokenType typ header of the ID tokens, they are never accepted as access tokens
+	idTokenType = "id_token+jwt"
+)
+
+var (
+	// ErrIncompleteIDToken ...
+	ErrIncompleteIDToken = errors.New("id token needs an issuer, a subject and an audience")
+	// ErrIDToken ...
+	ErrIDToken = errors.New("id token is not an access token")
+)
+
+// ProviderMetadata OpenID Connect discovery document ( OpenID Connect Discovery 1.0 3 )
+type ProviderMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                     string   `json:"token_endpoint,omitempty"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint,omitempty"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported,omitempty"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+	ScopesSupported                   []string `json:"scopes_supported,omitempty"`
+	ClaimsSupported                   []string `json:"claims_supported,omitempty"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported,omitempty"`
+}
+
+// Discovery the metadata of a provider at the issuer url with the endpoints at their conventional paths
+// ( /authorize, /token, /introspect and JWKSPath ), change the fields for other paths
+func (s *TypedVerifierService[T]) Discovery(issuer string) *ProviderMetadata {
+	issuer = strings.TrimSuffix(issuer, "/")
+	var algs []string
+	if s.privateErr == nil {
+		algs = []string{s.method.Alg()}
+	} else if jwk, err := newJSONWebKey(s.publicKey); err == nil {
+		algs = []string{jwk.Alg}
+	}
+	return &ProviderMetadata{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/authorize",
+		TokenEndpoint:                     issuer + "/token",
+		IntrospectionEndpoint:             issuer + "/introspect",
+		JWKSURI:                           issuer + JWKSPath,
+		ResponseTypesSupported:            []string{"code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  algs,
+		GrantTypesSupported:               []string{GrantTypeAuthorizationCode, GrantTypeClientCredentials},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "private_key_jwt"},
+		ScopesSupported:                   []string{"openid"},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "at_hash", "azp", "name", "roles"},
+		CodeChallengeMethodsSupported:     []string{CodeChallengeMethodS256},
+	}
+}
+
+// ServeHTTP serve the document, ie: r.Method(http.MethodGet, authorizer.DiscoveryPath, metadata)
+func (m *ProviderMetadata) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	_ = json.NewEncoder(w).Encode(m)
+}
+
+// IDTokenOptions of IssueIDToken
+type IDTokenOptions struct {
+	ClientID    string        // aud and azp, required
+	Nonce       string        // nonce of the authentication request, as is
+	AuthTime    time.Time     // when the end user authenticated, auth_time is omitted when zero
+	AccessToken string        // access token issued along, at_hash is set when not empty
+	TTL         time.Duration // overrides the service expiry
+}
+
+// IDTokenClaims OpenID Connect Core 1.0 2
+type IDTokenClaims struct {
+	jwt.StandardClaims
+	Nonce    string   `json:"nonce,omitempty"`
+	AuthTime int64    `json:"auth_time,omitempty"`
+	AtHash   string   `json:"at_hash,omitempty"`
+	Azp      string   `json:"azp,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+// IssueIDToken an ID token of the end user of the claims ( sub, Details.Name and Details.Roles ) for a client.
+// The iss, exp and iat follow the service defaults like Sign, the typ header keeps it from passing as an access token.
+func (s *TypedVerifierService[T]) IssueIDToken(claims *Claims[T], opts IDTokenOptions) (string, error) {
+	if claims == nil {
+		return "", ErrMissingParams
+	}
+	if claims.Subject == "" || opts.ClientID == "" {
+		return "", ErrIncompleteIDToken
+	}
+	// own lifetime and audience, the details are not encrypted in an ID token
+	payload, err := s.prepare(&Claims[T]{
+		StandardClaims: jwt.StandardClaims{Issuer: claims.Issuer},
+	}, SignOptions{Audience: opts.ClientID, TTL: opts.TTL})
+	if err != nil {
+		return "", err
+	}
+	if payload.Issuer == "" {
+		return "", ErrIncompleteIDToken
+	}
+	// the subject is never salted, it must be stable for the client
+	payload.Subject = claims.Subject
+
+	idClaims := &IDTokenClaims{
+		StandardClaims: payload.StandardClaims,
+		Nonce:          opts.Nonce,
+		Azp:            payload.Audience,
+	}
+	if !opts.AuthTime.IsZero() {
+		idClaims.AuthTime = opts.AuthTime.Unix()
+	}
+	if claims.Details != nil {
+		idClaims.Name = claims.Details.Name
+		idClaims.Roles = claims.Details.Roles
+	}
+	if opts.AccessToken != "" {
+		if s.privateErr != nil {
+			return "", s.privateErr
+		}
+		idClaims.AtHash = tokenHash(s.method, opts.AccessToken)
+	}
+	return s.signToken(idClaims, map[string]interface{}{"typ": idTokenType})
+}
+
+// tokenHash left half of the hash of the token with the hash of the signing alg ( OpenID Connect Core 1.0 3.1.3.6 )
+func tokenHash(method jwt.SigningMethod, token string) string {
+	hash := crypto.SHA256
+	switch m := method.(type) {
+	case *jwt.SigningMethodRSA:
+		hash = m.Hash
+	case *jwt.SigningMethodECDSA:
+		hash = m.Hash
+	}
+	h := hash.New()
+	h.Write([]byte(token))
+	sum := h.Sum(nil)
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
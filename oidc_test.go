@@ -0,0 +1,156 @@
+package authorizer_test
+
+import (
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+	"github.com/bayugyug/authorizer/authorizertest"
+)
+
+var _ = Describe("OpenIDConnect", func() {
+
+	var (
+		keys     = authorizertest.NewRSAKeyPair(GinkgoT(), 2048)
+		verifier *authorizer.VerifierService
+	)
+
+	BeforeEach(func() {
+		var err error
+		verifier, err = authorizer.New(
+			authorizer.WithKeys(keys.PrivateKey, keys.PublicKey),
+			authorizer.WithTokenSource(authorizertest.DefaultTokenSource),
+			authorizer.WithIssuer("https://auth.example.com"),
+		)
+		Expect(err).To(BeNil())
+	})
+
+	get := func(handler http.Handler, target string) map[string]interface{} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Header().Get("Content-Type")).To(Equal("application/json"))
+		body := map[string]interface{}{}
+		Expect(json.Unmarshal(w.Body.Bytes(), &body)).To(Succeed())
+		return body
+	}
+
+	Context("Discovery document", func() {
+		It("Prepare", func() {
+
+			body := get(verifier.Discovery("https://auth.example.com/"), authorizer.DiscoveryPath)
+			Expect(body["issuer"]).To(Equal("https://auth.example.com"))
+			Expect(body["jwks_uri"]).To(Equal("https://auth.example.com/.well-known/jwks.json"))
+			Expect(body["token_endpoint"]).To(Equal("https://auth.example.com/token"))
+			Expect(body["id_token_signing_alg_values_supported"]).To(Equal([]interface{}{"RS256"}))
+			Expect(body["response_types_supported"]).To(Equal([]interface{}{"code"}))
+			Expect(body["subject_types_supported"]).To(Equal([]interface{}{"public"}))
+
+			By("Discovery document ok")
+		})
+	})
+
+	Context("JWKS verifies the tokens", func() {
+		It("Prepare", func() {
+
+			body := get(verifier.JWKSHandler(), authorizer.JWKSPath)
+			keys := body["keys"].([]interface{})
+			Expect(keys).To(HaveLen(1))
+			jwk := keys[0].(map[string]interface{})
+			Expect(jwk["kty"]).To(Equal("RSA"))
+			Expect(jwk["use"]).To(Equal("sig"))
+			Expect(jwk["alg"]).To(Equal("RS256"))
+
+			n, _ := base64.RawURLEncoding.DecodeString(jwk["n"].(string))
+			e, _ := base64.RawURLEncoding.DecodeString(jwk["e"].(string))
+			pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+			token, err := verifier.Sign(&authorizer.AuthClaims{StandardClaims: jwt.StandardClaims{Subject: "user-1001"}})
+			Expect(err).To(BeNil())
+			parsed, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
+				Expect(t.Header["kid"]).To(Equal(jwk["kid"]))
+				return pub, nil
+			})
+			Expect(err).To(BeNil())
+			Expect(parsed.Valid).To(BeTrue())
+
+			By("EC keys")
+			ec := authorizertest.NewECKeyPair(GinkgoT(), elliptic.P384())
+			ecVerifier, err := authorizer.New(authorizer.WithPublicKey(ec.PublicKey), authorizer.WithTokenSource(authorizertest.DefaultTokenSource))
+			Expect(err).To(BeNil())
+			set, err := ecVerifier.JWKS()
+			Expect(err).To(BeNil())
+			Expect(set.Keys[0].Crv).To(Equal("P-384"))
+			Expect(set.Keys[0].Alg).To(Equal("ES384"))
+			Expect(ecVerifier.Discovery("https://auth.example.com").IDTokenSigningAlgValuesSupported).To(Equal([]string{"ES384"}))
+
+			By("JWKS verifies the tokens ok")
+		})
+	})
+
+	Context("ID token", func() {
+		It("Prepare", func() {
+
+			accessToken, err := verifier.Sign(&authorizer.AuthClaims{StandardClaims: jwt.StandardClaims{Subject: "user-1001"}})
+			Expect(err).To(BeNil())
+			authTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+			idToken, err := verifier.IssueIDToken(&authorizer.AuthClaims{
+				StandardClaims: jwt.StandardClaims{Subject: "user-1001", Audience: "orders-api"},
+				Details:        &authorizer.Details{Name: "juan", Roles: []string{"admin"}},
+			}, authorizer.IDTokenOptions{
+				ClientID:    "web-app",
+				Nonce:       "n-0S6_WzA2Mj",
+				AuthTime:    authTime,
+				AccessToken: accessToken,
+				TTL:         5 * time.Minute,
+			})
+			Expect(err).To(BeNil())
+
+			claims := &authorizer.IDTokenClaims{}
+			parsed, err := jwt.ParseWithClaims(idToken, claims, func(*jwt.Token) (interface{}, error) {
+				return authorizer.ParsePublicKey(keys.PublicKey)
+			})
+			Expect(err).To(BeNil())
+			Expect(parsed.Header["typ"]).To(Equal("id_token+jwt"))
+			Expect(claims.Issuer).To(Equal("https://auth.example.com"))
+			Expect(claims.Subject).To(Equal("user-1001"))
+			Expect(claims.Audience).To(Equal("web-app"))
+			Expect(claims.Azp).To(Equal("web-app"))
+			Expect(claims.Nonce).To(Equal("n-0S6_WzA2Mj"))
+			Expect(claims.AuthTime).To(Equal(authTime.Unix()))
+			Expect(claims.Name).To(Equal("juan"))
+			Expect(claims.ExpiresAt - claims.IssuedAt).To(BeNumerically("==", 300))
+
+			sum := sha256.Sum256([]byte(accessToken))
+			Expect(claims.AtHash).To(Equal(base64.RawURLEncoding.EncodeToString(sum[:16])))
+
+			By("never an access token")
+			_, err = verifier.Verify(idToken)
+			Expect(errors.Is(err, authorizer.ErrIDToken)).To(BeTrue())
+			req := authorizertest.NewRequest(http.MethodGet, "/orders", nil, authorizer.TokenSource{AuthBearer: true}, idToken)
+			_, err = verifier.UnSign(req)
+			Expect(errors.Is(err, authorizer.ErrIDToken)).To(BeTrue())
+
+			By("subject and client are required")
+			_, err = verifier.IssueIDToken(&authorizer.AuthClaims{}, authorizer.IDTokenOptions{ClientID: "web-app"})
+			Expect(errors.Is(err, authorizer.ErrIncompleteIDToken)).To(BeTrue())
+			_, err = verifier.IssueIDToken(&authorizer.AuthClaims{StandardClaims: jwt.StandardClaims{Subject: "user-1001"}}, authorizer.IDTokenOptions{})
+			Expect(errors.Is(err, authorizer.ErrIncompleteIDToken)).To(BeTrue())
+
+			By("ID token ok")
+		})
+	})
+})
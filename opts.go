@@ -1,20 +1,282 @@
 package authorizer
 
 import (
+	"crypto"
 	"crypto/md5"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
 // Options ...
 type Options struct {
-	PrivateKey  string
-	PublicKey   string
-	TokenSource TokenSource
-	Expiry      int
+	PrivateKey   string
+	PublicKey    string
+	TokenSource  TokenSource
+	Expiry       int
+	Issuer       string        // default issuer (iss) when the payload has none
+	Audience     string        // default audience (aud) when the payload has none
+	SaltSubject  bool          // treat the payload Subject as a salt and replace it with its hash
+	ExpiresIn    time.Duration // overrides Expiry ( minutes ) when set
+	Extractors   []Extractor   // extra token sources, tried after the TokenSource
+	CacheSize    int           // max verified tokens kept, the cache is off when zero
+	CacheTTL     time.Duration // max time a verified token is kept, capped by its exp
+	Revocation   RevocationChecker
+	BatchWorkers int // max concurrent verifications of VerifyBatch, defaults to GOMAXPROCS
+	// MaxTokenBytes largest token accepted by Verify, DefaultMaxTokenBytes when zero, no limit when negative
+	MaxTokenBytes int
+
+	// EncryptionKey pem public key ( RSA or EC ) of the recipient, Sign produces nested JWTs
+	// ( signed then encrypted, RSA-OAEP or ECDH-ES with A256GCM ) when set
+	EncryptionKey string
+	// DecryptionKey pem private key, Verify/UnSign decrypt nested JWTs with it
+	DecryptionKey string
+
+	// FieldKey base64 AES key, the EncryptFields of the Details are AES-GCM encrypted by Sign
+	// and decrypted by Verify/UnSign, the other claims stay readable
+	FieldKey string
+	// EncryptFields uuid, auth_token, refresh_token, auth_type, name, method ( DefaultEncryptFields when empty )
+	EncryptFields []string
+
+	// Algorithms accepted alg of the verified tokens ( RS256, RS384, RS512, ES256, ES384, ES512 ),
+	// any of the public key type when empty; none and HMAC are never accepted
+	Algorithms []string
+	// MinRSABits smallest RSA modulus of the keys, DefaultMinRSABits when zero, a lower one only when set explicitly
+	MinRSABits int
+	// ECCurves accepted curves of the EC keys ( P-256, P-384, P-521 ), any when empty
+	ECCurves []string
+	// RejectKeyHeaders reject the tokens with a jku, jwk, x5u or x5c header instead of ignoring it,
+	// the verification key never comes from the token
+	RejectKeyHeaders bool
+}
+
+// Option functional option for New
+type Option func(*Options)
+
+// WithOptions start from an existing Options ( ie: loaded from a config )
+func WithOptions(opts *Options) Option {
+	return func(o *Options) {
+		if opts != nil {
+			*o = *opts
+		}
+	}
+}
+
+// WithKeys pem encoded private/public keys
+func WithKeys(privateKey, publicKey string) Option {
+	return func(o *Options) {
+		o.PrivateKey = privateKey
+		o.PublicKey = publicKey
+	}
+}
+
+// WithPublicKey pem encoded public key only ( verify only service )
+func WithPublicKey(publicKey string) Option {
+	return func(o *Options) {
+		o.PublicKey = publicKey
+	}
+}
+
+// WithEncryption pem encoded keys of the nested JWTs, separate from the signing keys.
+// Either may be empty: encrypt only ( issuer ) or decrypt only ( consumer ).
+func WithEncryption(encryptionKey, decryptionKey string) Option {
+	return func(o *Options) {
+		o.EncryptionKey = encryptionKey
+		o.DecryptionKey = decryptionKey
+	}
+}
+
+// WithFieldEncryption base64 AES key and the Details fields to encrypt ( DefaultEncryptFields when none )
+func WithFieldEncryption(key string, fields ...string) Option {
+	return func(o *Options) {
+		o.FieldKey = key
+		o.EncryptFields = fields
+	}
+}
+
+// WithAlgorithms accepted alg of the verified tokens
+func WithAlgorithms(algs ...string) Option {
+	return func(o *Options) {
+		o.Algorithms = algs
+	}
+}
+
+// WithKeyPolicy smallest RSA modulus ( DefaultMinRSABits when zero, ie: 1024 to accept legacy keys )
+// and accepted EC curves ( any when none )
+func WithKeyPolicy(minRSABits int, curves ...string) Option {
+	return func(o *Options) {
+		o.MinRSABits = minRSABits
+		o.ECCurves = curves
+	}
+}
+
+// WithRejectKeyHeaders ...
+func WithRejectKeyHeaders(reject bool) Option {
+	return func(o *Options) {
+		o.RejectKeyHeaders = reject
+	}
+}
+
+// WithExpiry default token lifetime
+func WithExpiry(d time.Duration) Option {
+	return func(o *Options) {
+		o.ExpiresIn = d
+	}
+}
+
+// WithIssuer default issuer
+func WithIssuer(issuer string) Option {
+	return func(o *Options) {
+		o.Issuer = issuer
+	}
+}
+
+// WithAudience default audience
+func WithAudience(audience string) Option {
+	return func(o *Options) {
+		o.Audience = audience
+	}
+}
+
+// WithTokenSource ...
+func WithTokenSource(src TokenSource) Option {
+	return func(o *Options) {
+		o.TokenSource = src
+	}
+}
+
+// WithExtractors extra token sources
+func WithExtractors(extractors ...Extractor) Option {
+	return func(o *Options) {
+		o.Extractors = append(o.Extractors, extractors...)
+	}
+}
+
+// WithCache keep up to size verified tokens for at most ttl ( or until their exp when zero )
+func WithCache(size int, ttl time.Duration) Option {
+	return func(o *Options) {
+		o.CacheSize = size
+		o.CacheTTL = ttl
+	}
+}
+
+// WithRevocation checked on every verification, cached tokens included
+func WithRevocation(checker RevocationChecker) Option {
+	return func(o *Options) {
+		o.Revocation = checker
+	}
+}
+
+// WithBatchWorkers ...
+func WithBatchWorkers(workers int) Option {
+	return func(o *Options) {
+		o.BatchWorkers = workers
+	}
+}
+
+// WithMaxTokenBytes largest token accepted by Verify ( DefaultMaxTokenBytes when zero, no limit when negative )
+func WithMaxTokenBytes(size int) Option {
+	return func(o *Options) {
+		o.MaxTokenBytes = size
+	}
+}
+
+// WithSaltSubject ...
+func WithSaltSubject(salt bool) Option {
+	return func(o *Options) {
+		o.SaltSubject = salt
+	}
+}
+
+// Validate check every setting, all the problems found are joined in the error
+func (o *Options) Validate() error {
+	var errs []error
+
+	// keys
+	var pub crypto.PublicKey
+	if strings.TrimSpace(o.PublicKey) == "" {
+		errs = append(errs, ErrMissingPublicKey)
+	} else if key, err := ParsePublicKey(formatKey(o.PublicKey)); err != nil {
+		errs = append(errs, fmt.Errorf("public key: %w", err))
+	} else if err := o.checkKeyPolicy(key); err != nil {
+		errs = append(errs, fmt.Errorf("public key: %w", err))
+	} else {
+		pub = key
+	}
+	if strings.TrimSpace(o.PrivateKey) != "" {
+		key, err := ParsePrivateKey(formatKey(o.PrivateKey))
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("private key: %w", err))
+		case pub != nil && !sameKey(publicKeyOf(key), pub):
+			errs = append(errs, ErrKeyMismatch)
+		default:
+			if err := o.checkSigningKey(key); err != nil {
+				errs = append(errs, fmt.Errorf("private key: %w", err))
+			}
+		}
+	}
+
+	// encryption
+	if strings.TrimSpace(o.EncryptionKey) != "" {
+		if key, err := ParsePublicKey(formatKey(o.EncryptionKey)); err != nil {
+			errs = append(errs, fmt.Errorf("encryption key: %w", err))
+		} else if err := o.checkKeyPolicy(key); err != nil {
+			errs = append(errs, fmt.Errorf("encryption key: %w", err))
+		}
+	}
+	if strings.TrimSpace(o.DecryptionKey) != "" {
+		if key, err := ParsePrivateKey(formatKey(o.DecryptionKey)); err != nil {
+			errs = append(errs, fmt.Errorf("decryption key: %w", err))
+		} else if err := o.checkKeyPolicy(key); err != nil {
+			errs = append(errs, fmt.Errorf("decryption key: %w", err))
+		}
+	}
+
+	// algorithms
+	if err := checkAlgorithms(o.Algorithms); err != nil {
+		errs = append(errs, err)
+	}
+	if o.MinRSABits < 0 {
+		errs = append(errs, fmt.Errorf("%w: negative min rsa bits", ErrKeyPolicy))
+	}
+
+	if _, err := newFieldCipher(o.FieldKey, o.EncryptFields); err != nil {
+		errs = append(errs, fmt.Errorf("field encryption: %w", err))
+	}
+
+	// batch
+	if o.BatchWorkers < 0 {
+		errs = append(errs, ErrInvalidBatchWorkers)
+	}
+
+	// expiry
+	if o.Expiry < 0 || o.ExpiresIn < 0 {
+		errs = append(errs, ErrInvalidExpiry)
+	}
+
+	// cache
+	if o.CacheSize < 0 || o.CacheTTL < 0 {
+		errs = append(errs, ErrInvalidCache)
+	}
+
+	// token source
+	if len(o.extractors()) == 0 {
+		errs = append(errs, ErrMissingTokenSource)
+	}
+	return errors.Join(errs...)
+}
+
+// SignOptions per call overrides of the service defaults
+type SignOptions struct {
+	Issuer   string        // overrides Options.Issuer
+	Audience string        // overrides Options.Audience
+	ID       string        // jti, a random uuid is generated when empty
+	TTL      time.Duration // overrides Options.Expiry
+	Salt     string        // replace the Subject with the hash of this salt
 }
 
 // TokenSource ...
@@ -31,25 +293,51 @@ var (
 	DefaultExpiry = 2800 // minutes  ( 2 days default )
 	// DefaultGetQueryParam ...
 	DefaultGetQueryParam = "verifier"
+	// DefaultMaxTokenBytes largest token accepted by Verify, nested JWTs included
+	DefaultMaxTokenBytes = 16 << 10
 	// ErrMissingParams ...
 	ErrMissingParams = errors.New("missing required parameters")
 	// ErrEmptyToken ...
 	ErrEmptyToken = errors.New("empty token")
+	// ErrTokenTooLarge ...
+	ErrTokenTooLarge = errors.New("token too large")
 	// ErrInvalidToken ...
 	ErrInvalidToken = errors.New("invalid token")
 	// ErrConvertClaims ...
 	ErrConvertClaims = errors.New("fail convert claims")
+	// ErrMissingPublicKey ...
+	ErrMissingPublicKey = errors.New("missing public key")
+	// ErrMissingPrivateKey ...
+	ErrMissingPrivateKey = errors.New("missing private key")
+	// ErrKeyMismatch ...
+	ErrKeyMismatch = errors.New("private key does not match the public key")
+	// ErrInvalidExpiry ...
+	ErrInvalidExpiry = errors.New("expiry must not be negative")
+	// ErrInvalidCache ...
+	ErrInvalidCache = errors.New("cache size and ttl must not be negative")
+	// ErrRevokedToken ...
+	ErrRevokedToken = errors.New("revoked token")
+	// ErrInvalidBatchWorkers ...
+	ErrInvalidBatchWorkers = errors.New("batch workers must not be negative")
+	// ErrUnsupportedKey ...
+	ErrUnsupportedKey = errors.New("unsupported key type")
+	// ErrMissingTokenSource ...
+	ErrMissingTokenSource = errors.New("missing token source")
 )
 
-// AuthClaims custom claims
-type AuthClaims struct {
-	jwt.StandardClaims             // standard claims
-	MetaInfo           interface{} `json:"meta_info,omitempty"`
-	Details            *Details    `json:"details,omitempty"`
+// Claims custom claims with a caller supplied MetaInfo type
+type Claims[T any] struct {
+	jwt.StandardClaims          // standard claims
+	MetaInfo           T        `json:"meta_info,omitempty"`
+	Details            *Details `json:"details,omitempty"`
+	Scope              string   `json:"scope,omitempty"` // space separated ( RFC 8693 )
 }
 
+// AuthClaims custom claims with an untyped MetaInfo
+type AuthClaims = Claims[interface{}]
+
 // SetSubject ...
-func (s *AuthClaims) SetSubject(salt string) string {
+func (s *Claims[T]) SetSubject(salt string) string {
 	return fmt.Sprintf("%x",
 		md5.Sum([]byte(
 			fmt.Sprintf("%s/%d/%s",
@@ -61,7 +349,7 @@ func (s *AuthClaims) SetSubject(salt string) string {
 }
 
 // CheckSubject ...
-func (s *AuthClaims) CheckSubject(salt string) bool {
+func (s *Claims[T]) CheckSubject(salt string) bool {
 	return strings.EqualFold(s.SetSubject(salt), s.Subject)
 }
 
@@ -75,3 +363,41 @@ type Details struct {
 	Method       string   `json:"method,omitempty"`
 	Roles        []string `json:"roles,omitempty"`
 }
+
+// HasRole ...
+func (s *Claims[T]) HasRole(role string) bool {
+	if s.Details == nil {
+		return false
+	}
+	for _, r := range s.Details.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Scopes the space separated scope claim
+func (s *Claims[T]) Scopes() []string {
+	return strings.Fields(s.Scope)
+}
+
+// HasScope ...
+func (s *Claims[T]) HasScope(scope string) bool {
+	for _, v := range s.Scopes() {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAnyRole ...
+func (s *Claims[T]) HasAnyRole(roles ...string) bool {
+	for _, role := range roles {
+		if s.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,446 @@
+package authorizer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultPolicyDecisionHeader response header of the explain mode
+	DefaultPolicyDecisionHeader = "X-Policy-Decision"
+)
+
+var (
+	// ErrInvalidPolicy ...
+	ErrInvalidPolicy = errors.New("invalid policy")
+)
+
+// PolicyFile json/yaml form of the route policy
+//
+//	explain: true
+//	rules:
+//	  - name: delete-orders
+//	    methods: [DELETE]
+//	    path: /orders/{id:[0-9]+}
+//	    roles: [admin]
+//	  - path: /orders/*
+//	    scopes: [orders:read]
+//	    claims:
+//	      meta_info.tenant: [acme, globex]
+type PolicyFile struct {
+	// Explain report the deciding rule in the X-Policy-Decision response header
+	Explain bool         `json:"explain,omitempty" yaml:"explain,omitempty"`
+	Rules   []PolicyRule `json:"rules" yaml:"rules"`
+}
+
+// PolicyRule requirements of the requests matching the methods and the path pattern.
+//
+// The path is chi style: "{name}" or "{name:regexp}" matches one segment,
+// a trailing "*" matches the rest of the path.
+type PolicyRule struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Methods empty for all of them
+	Methods []string `json:"methods,omitempty" yaml:"methods,omitempty"`
+	Path    string   `json:"path" yaml:"path"`
+	// Roles any one of them
+	Roles []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	// Scopes all of them
+	Scopes []string `json:"scopes,omitempty" yaml:"scopes,omitempty"`
+	// Claims every claim must equal one of its values ( see ClaimValues for the names )
+	Claims map[string][]string `json:"claims,omitempty" yaml:"claims,omitempty"`
+}
+
+// PolicyDecision outcome of a request, Rule is empty when nothing matched
+type PolicyDecision struct {
+	Allowed bool
+	Rule    string
+	Reason  string
+}
+
+// String explain form, ie: deny rule="delete-orders" reason="missing role: admin"
+func (d PolicyDecision) String() string {
+	effect := "deny"
+	if d.Allowed {
+		effect = "allow"
+	}
+	return fmt.Sprintf("%s rule=%q reason=%q", effect, d.Rule, d.Reason)
+}
+
+// Policy compiled route policy, deny by default
+type Policy struct {
+	explain bool
+	rules   []*policyRule
+}
+
+// policyRule ...
+type policyRule struct {
+	PolicyRule
+	index      int
+	claimNames []string
+	segments   []pathSegment
+	rest       bool
+	literals   int
+}
+
+// pathSegment literal or parameter with an optional pattern
+type pathSegment struct {
+	literal string
+	param   bool
+	pattern *regexp.Regexp
+}
+
+// LoadPolicy read a json ( .json ) or yaml ( any other extension ) policy file
+func LoadPolicy(path string) (*Policy, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	format := "yaml"
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		format = "json"
+	}
+	return ParsePolicy(raw, format)
+}
+
+// ParsePolicy decode and compile a json or yaml policy document
+func ParsePolicy(raw []byte, format string) (*Policy, error) {
+	file := &PolicyFile{}
+	var err error
+	switch strings.ToLower(format) {
+	case "json":
+		err = json.Unmarshal(raw, file)
+	case "yaml", "yml":
+		err = yaml.Unmarshal(raw, file)
+	default:
+		err = fmt.Errorf("unsupported policy format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewPolicy(file)
+}
+
+// NewPolicy compile the rules, most specific first
+func NewPolicy(file *PolicyFile) (*Policy, error) {
+	if file == nil {
+		file = &PolicyFile{}
+	}
+	p := &Policy{explain: file.Explain}
+	for i, rule := range file.Rules {
+		compiled, err := compileRule(i, rule)
+		if err != nil {
+			return nil, err
+		}
+		p.rules = append(p.rules, compiled)
+	}
+
+	// more literal segments, more segments, exact before "*", method specific before any, file order
+	sort.SliceStable(p.rules, func(i, j int) bool {
+		a, b := p.rules[i], p.rules[j]
+		switch {
+		case a.literals != b.literals:
+			return a.literals > b.literals
+		case len(a.segments) != len(b.segments):
+			return len(a.segments) > len(b.segments)
+		case a.rest != b.rest:
+			return !a.rest
+		case (len(a.Methods) > 0) != (len(b.Methods) > 0):
+			return len(a.Methods) > 0
+		}
+		return a.index < b.index
+	})
+	return p, nil
+}
+
+// compileRule ...
+func compileRule(index int, rule PolicyRule) (*policyRule, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: rule %d ( %s ): %s", ErrInvalidPolicy, index, rule.Path, fmt.Sprintf(format, args...))
+	}
+	if !strings.HasPrefix(rule.Path, "/") {
+		return nil, invalid("path must start with /")
+	}
+	rule.Methods = append([]string(nil), rule.Methods...)
+	for i, method := range rule.Methods {
+		if method == "" || strings.ContainsAny(method, " /") {
+			return nil, invalid("bad method %q", method)
+		}
+		rule.Methods[i] = strings.ToUpper(method)
+	}
+	claimNames := make([]string, 0, len(rule.Claims))
+	for claim := range rule.Claims {
+		if !knownClaim(claim) {
+			return nil, invalid("unknown claim %q", claim)
+		}
+		claimNames = append(claimNames, claim)
+	}
+	sort.Strings(claimNames)
+	if rule.Name == "" {
+		rule.Name = strings.TrimSpace(strings.Join(rule.Methods, ",") + " " + rule.Path)
+	}
+
+	out := &policyRule{PolicyRule: rule, index: index, claimNames: claimNames}
+	parts := splitPath(rule.Path)
+	for i, part := range parts {
+		switch {
+		case part == "*":
+			if i != len(parts)-1 {
+				return nil, invalid("* is only allowed at the end")
+			}
+			out.rest = true
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+			seg := pathSegment{param: true}
+			if _, expr, ok := strings.Cut(part[1:len(part)-1], ":"); ok {
+				re, err := regexp.Compile("^(?:" + expr + ")$")
+				if err != nil {
+					return nil, invalid("%v", err)
+				}
+				seg.pattern = re
+			}
+			out.segments = append(out.segments, seg)
+		case strings.ContainsAny(part, "{}*"):
+			return nil, invalid("bad segment %q", part)
+		default:
+			out.segments = append(out.segments, pathSegment{literal: part})
+			out.literals++
+		}
+	}
+	return out, nil
+}
+
+// splitPath "/a/b/" -> [a b], "/" -> []
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// match ...
+func (rule *policyRule) match(method string, parts []string) bool {
+	if len(rule.Methods) > 0 {
+		found := false
+		for _, m := range rule.Methods {
+			if m == method {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(parts) < len(rule.segments) || (!rule.rest && len(parts) != len(rule.segments)) {
+		return false
+	}
+	for i, seg := range rule.segments {
+		switch {
+		case !seg.param:
+			if parts[i] != seg.literal {
+				return false
+			}
+		case seg.pattern != nil:
+			if !seg.pattern.MatchString(parts[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// check the requirements of a matching rule, the reason of the denial if any
+func (rule *policyRule) check(claims *AuthClaims) string {
+	if len(rule.Roles) > 0 && !claims.HasAnyRole(rule.Roles...) {
+		return "missing role: " + strings.Join(rule.Roles, "|")
+	}
+	for _, scope := range rule.Scopes {
+		if !claims.HasScope(scope) {
+			return "missing scope: " + scope
+		}
+	}
+	for _, claim := range rule.claimNames {
+		if !anyEqual(ClaimValues(claims, claim), rule.Claims[claim]) {
+			return "claim mismatch: " + claim
+		}
+	}
+	return ""
+}
+
+// Evaluate the most specific matching rule decides, no match is a denial
+func (p *Policy) Evaluate(method, path string, claims *AuthClaims) PolicyDecision {
+	if claims == nil {
+		return PolicyDecision{Reason: "missing claims"}
+	}
+	method = strings.ToUpper(method)
+	parts := splitPath(path)
+	for _, rule := range p.rules {
+		if !rule.match(method, parts) {
+			continue
+		}
+		if reason := rule.check(claims); reason != "" {
+			return PolicyDecision{Rule: rule.Name, Reason: reason}
+		}
+		return PolicyDecision{Allowed: true, Rule: rule.Name, Reason: "requirements met"}
+	}
+	return PolicyDecision{Reason: "no matching rule"}
+}
+
+// Middleware chi compatible, 401 when the token does not verify, 403 when the policy denies.
+// The claims of the allowed requests are in the context ( ClaimsFromContext ).
+func (p *Policy) Middleware(verifier VerifierServiceCreator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := verifier.UnSign(r)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			decision := p.Evaluate(r.Method, routingPath(r.URL), claims)
+			if p.explain {
+				w.Header().Set(DefaultPolicyDecisionHeader, decision.String())
+			}
+			if !decision.Allowed {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+		})
+	}
+}
+
+// routingPath the path chi routes on ( the escaped one when the request has it ), cleaned,
+// so the rule evaluated is the one of the handler that serves the request
+func routingPath(u *url.URL) string {
+	raw := u.Path
+	if u.RawPath != "" {
+		raw = u.RawPath
+	}
+	if raw == "" {
+		return "/"
+	}
+	cleaned := path.Clean(raw)
+	if strings.HasSuffix(raw, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// claimsContextKey ...
+type claimsContextKey struct{}
+
+// NewContext carry the verified claims
+func NewContext(ctx context.Context, claims *AuthClaims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext the claims stored by NewContext
+func ClaimsFromContext(ctx context.Context) (*AuthClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*AuthClaims)
+	return claims, ok && claims != nil
+}
+
+// claimValues readers of the named claims
+var claimValues = map[string]func(claims *AuthClaims) []string{
+	"sub":   func(claims *AuthClaims) []string { return nonEmpty(claims.Subject) },
+	"iss":   func(claims *AuthClaims) []string { return nonEmpty(claims.Issuer) },
+	"aud":   func(claims *AuthClaims) []string { return nonEmpty(claims.Audience) },
+	"jti":   func(claims *AuthClaims) []string { return nonEmpty(claims.Id) },
+	"scope": func(claims *AuthClaims) []string { return claims.Scopes() },
+	"uuid": func(claims *AuthClaims) []string {
+		return detailsValue(claims, func(d *Details) []string { return nonEmpty(d.UUID) })
+	},
+	"name": func(claims *AuthClaims) []string {
+		return detailsValue(claims, func(d *Details) []string { return nonEmpty(d.Name) })
+	},
+	"auth_type": func(claims *AuthClaims) []string {
+		return detailsValue(claims, func(d *Details) []string { return nonEmpty(d.AuthType) })
+	},
+	"method": func(claims *AuthClaims) []string {
+		return detailsValue(claims, func(d *Details) []string { return nonEmpty(d.Method) })
+	},
+	"roles": func(claims *AuthClaims) []string {
+		return detailsValue(claims, func(d *Details) []string { return d.Roles })
+	},
+}
+
+// knownClaim ...
+func knownClaim(name string) bool {
+	if _, ok := claimValues[name]; ok {
+		return true
+	}
+	key, ok := strings.CutPrefix(name, "meta_info.")
+	return ok && key != ""
+}
+
+// ClaimValues string values of a claim: sub, iss, aud, jti, scope, uuid, name,
+// auth_type, method, roles or meta_info.<key> ( string, bool, number or a list of them )
+func ClaimValues(claims *AuthClaims, name string) []string {
+	if claims == nil {
+		return nil
+	}
+	if fn, ok := claimValues[name]; ok {
+		return fn(claims)
+	}
+	key, ok := strings.CutPrefix(name, "meta_info.")
+	if !ok {
+		return nil
+	}
+	meta, ok := claims.MetaInfo.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	switch v := meta[key].(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			out = append(out, fmt.Sprint(item))
+		}
+		return out
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// detailsValue ...
+func detailsValue(claims *AuthClaims, fn func(d *Details) []string) []string {
+	if claims.Details == nil {
+		return nil
+	}
+	return fn(claims.Details)
+}
+
+// nonEmpty ...
+func nonEmpty(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return []string{v}
+}
+
+// anyEqual ...
+func anyEqual(values, allowed []string) bool {
+	for _, v := range values {
+		for _, a := range allowed {
+			if v == a {
+				return true
+			}
+		}
+	}
+	return false
+}
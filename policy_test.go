@@ -0,0 +1,202 @@
+package authorizer_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/go-chi/chi"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+	"github.com/bayugyug/authorizer/authorizertest"
+)
+
+var _ = Describe("Policy", func() {
+
+	const policyYAML = `
+explain: true
+rules:
+  - name: delete-order
+    methods: [DELETE]
+    path: /orders/{id:[0-9]+}
+    roles: [admin]
+  - name: order
+    path: /orders/{id}
+    scopes: [orders:read]
+    claims:
+      meta_info.tenant: [acme, globex]
+  - name: orders
+    path: /orders/*
+    roles: [user]
+  - name: reports
+    methods: [get]
+    path: /reports
+    claims:
+      auth_type: [internal]
+`
+
+	var (
+		policy *authorizer.Policy
+		tokens *authorizertest.TokenFactory
+		claims func(opts ...authorizertest.ClaimsOption) *authorizer.AuthClaims
+	)
+
+	BeforeEach(func() {
+		var err error
+		policy, err = authorizer.ParsePolicy([]byte(policyYAML), "yaml")
+		Expect(err).To(BeNil())
+
+		verifier := authorizertest.NewVerifier(GinkgoT())
+		tokens = authorizertest.NewTokenFactory(GinkgoT(), verifier)
+		claims = tokens.Claims
+	})
+
+	withScope := func(scope string) authorizertest.ClaimsOption {
+		return func(c *authorizer.AuthClaims) { c.Scope = scope }
+	}
+	withTenant := func(tenant string) authorizertest.ClaimsOption {
+		return authorizertest.WithMetaInfo(map[string]interface{}{"tenant": tenant})
+	}
+
+	Context("Most specific rule first", func() {
+		It("Prepare", func() {
+
+			admin := claims(authorizertest.WithRoles("admin"))
+			user := claims(authorizertest.WithRoles("user"), withScope("orders:read profile"), withTenant("acme"))
+
+			decision := policy.Evaluate(http.MethodDelete, "/orders/1001", user)
+			Expect(decision.Allowed).To(BeFalse())
+			Expect(decision.Rule).To(Equal("delete-order"))
+			Expect(decision.Reason).To(ContainSubstring("admin"))
+
+			Expect(policy.Evaluate(http.MethodDelete, "/orders/1001", admin).Allowed).To(BeTrue())
+
+			// not a number, falls to the generic order rule
+			decision = policy.Evaluate(http.MethodDelete, "/orders/latest", user)
+			Expect(decision.Rule).To(Equal("order"))
+			Expect(decision.Allowed).To(BeTrue())
+
+			decision = policy.Evaluate(http.MethodGet, "/orders/1001/items/1", user)
+			Expect(decision.Rule).To(Equal("orders"))
+			Expect(decision.Allowed).To(BeTrue())
+
+			By("Most specific rule first ok")
+		})
+	})
+
+	Context("Scopes and claim conditions", func() {
+		It("Prepare", func() {
+
+			decision := policy.Evaluate(http.MethodGet, "/orders/1001", claims(withScope("profile"), withTenant("acme")))
+			Expect(decision.Allowed).To(BeFalse())
+			Expect(decision.Reason).To(Equal("missing scope: orders:read"))
+
+			decision = policy.Evaluate(http.MethodGet, "/orders/1001", claims(withScope("orders:read"), withTenant("initech")))
+			Expect(decision.Allowed).To(BeFalse())
+			Expect(decision.Reason).To(Equal("claim mismatch: meta_info.tenant"))
+
+			internal := func(c *authorizer.AuthClaims) { c.Details.AuthType = "internal" }
+			Expect(policy.Evaluate(http.MethodGet, "/reports", claims(internal)).Allowed).To(BeTrue())
+			Expect(policy.Evaluate(http.MethodGet, "/reports", claims()).Allowed).To(BeFalse())
+
+			By("Scopes and claim conditions ok")
+		})
+	})
+
+	Context("Deny by default", func() {
+		It("Prepare", func() {
+
+			decision := policy.Evaluate(http.MethodPost, "/reports", claims())
+			Expect(decision.Allowed).To(BeFalse())
+			Expect(decision.Rule).To(BeEmpty())
+			Expect(decision.Reason).To(Equal("no matching rule"))
+
+			Expect(policy.Evaluate(http.MethodGet, "/", claims()).Allowed).To(BeFalse())
+
+			By("Deny by default ok")
+		})
+	})
+
+	Context("Invalid policies", func() {
+		It("Prepare", func() {
+
+			for _, doc := range []string{
+				`{"rules":[{"path":"orders"}]}`,
+				`{"rules":[{"path":"/*/orders"}]}`,
+				`{"rules":[{"path":"/orders/{id:[0-9}"}]}`,
+				`{"rules":[{"path":"/orders","claims":{"password":["x"]}}]}`,
+			} {
+				_, err := authorizer.ParsePolicy([]byte(doc), "json")
+				Expect(err).To(MatchError(authorizer.ErrInvalidPolicy), doc)
+			}
+
+			By("Invalid policies ok")
+		})
+	})
+
+	Context("Chi middleware with explain", func() {
+		It("Prepare", func() {
+
+			verifier := authorizertest.NewVerifier(GinkgoT())
+			tokens = authorizertest.NewTokenFactory(GinkgoT(), verifier)
+
+			router := chi.NewRouter()
+			router.Use(policy.Middleware(verifier))
+			router.Get("/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+				claims, ok := authorizer.ClaimsFromContext(r.Context())
+				Expect(ok).To(BeTrue())
+				_, _ = w.Write([]byte(claims.Subject))
+			})
+
+			serve := func(token string) *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, authorizertest.NewRequest(http.MethodGet, "/orders/1001", nil, authorizertest.DefaultTokenSource, token))
+				return w
+			}
+
+			w := serve(tokens.Valid(authorizertest.WithSubject("user-1001"), withScope("orders:read"), withTenant("globex")))
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(Equal("user-1001"))
+			Expect(w.Header().Get(authorizer.DefaultPolicyDecisionHeader)).To(Equal(`allow rule="order" reason="requirements met"`))
+
+			w = serve(tokens.Valid(withTenant("globex")))
+			Expect(w.Code).To(Equal(http.StatusForbidden))
+			Expect(w.Header().Get(authorizer.DefaultPolicyDecisionHeader)).To(HavePrefix(`deny rule="order"`))
+
+			Expect(serve(tokens.Expired()).Code).To(Equal(http.StatusUnauthorized))
+
+			By("Chi middleware with explain ok")
+		})
+	})
+
+	Context("Chi middleware on the routed path", func() {
+		It("Prepare", func() {
+
+			verifier := authorizertest.NewVerifier(GinkgoT())
+			tokens = authorizertest.NewTokenFactory(GinkgoT(), verifier)
+
+			var served string
+			router := chi.NewRouter()
+			router.Use(policy.Middleware(verifier))
+			router.Get("/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+				served = chi.URLParam(r, "id")
+			})
+
+			// chi routes /orders/1001%2Fitems to /orders/{id}, the policy must not see /orders/1001/items
+			user := tokens.Valid(authorizertest.WithRoles("user"))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, authorizertest.NewRequest(http.MethodGet, "/orders/1001%2Fitems", nil, authorizertest.DefaultTokenSource, user))
+			Expect(w.Code).To(Equal(http.StatusForbidden))
+			Expect(w.Header().Get(authorizer.DefaultPolicyDecisionHeader)).To(HavePrefix(`deny rule="order"`))
+			Expect(served).To(BeEmpty())
+
+			// dot segments are resolved
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, authorizertest.NewRequest(http.MethodGet, "/orders/x/../1001", nil, authorizertest.DefaultTokenSource, user))
+			Expect(w.Header().Get(authorizer.DefaultPolicyDecisionHeader)).To(HavePrefix(`deny rule="order"`))
+
+			By("Chi middleware on the routed path ok")
+		})
+	})
+})
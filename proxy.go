@@ -0,0 +1,432 @@
+package authorizer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultSignatureHeader ...
+	DefaultSignatureHeader = "X-Auth-Signature"
+	// DefaultSignedHeadersHeader ...
+	DefaultSignedHeadersHeader = "X-Auth-Signed-Headers"
+	// DefaultTimestampHeader ...
+	DefaultTimestampHeader = "X-Auth-Timestamp"
+)
+
+var (
+	// ErrMissingUpstream ...
+	ErrMissingUpstream = errors.New("missing upstream")
+	// ErrMissingForwardSecret ...
+	ErrMissingForwardSecret = errors.New("missing secret to sign the forwarded headers")
+	// ErrUnknownForwardClaim ...
+	ErrUnknownForwardClaim = errors.New("unknown claim to forward")
+	// ErrInvalidForwardSignature ...
+	ErrInvalidForwardSignature = errors.New("invalid forwarded headers signature")
+	// ErrInvalidPath ...
+	ErrInvalidPath = errors.New("invalid request path")
+)
+
+// ProxyConfig file form of the token verifying reverse proxy
+type ProxyConfig struct {
+	Listen   string       `json:"listen,omitempty" yaml:"listen,omitempty"`
+	Upstream string       `json:"upstream" yaml:"upstream"`
+	Verifier Config       `json:"verifier" yaml:"verifier"`
+	Routes   []ProxyRoute `json:"routes,omitempty" yaml:"routes,omitempty"`
+	Forward  ProxyForward `json:"forward,omitempty" yaml:"forward,omitempty"`
+	// Ingress forward-auth only, IngressTraefik or IngressNginx, whose headers carry the original request
+	Ingress string `json:"ingress,omitempty" yaml:"ingress,omitempty"`
+}
+
+// ProxyRoute roles required under a path prefix ( whole segments, case insensitive ), any one of them is enough
+type ProxyRoute struct {
+	Prefix string `json:"prefix" yaml:"prefix"`
+	// Methods the route applies to, empty for all of them
+	Methods []string `json:"methods,omitempty" yaml:"methods,omitempty"`
+	Roles   []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+}
+
+// ProxyForward claims passed to the upstream as HMAC signed headers
+type ProxyForward struct {
+	// Secret hmac key, inline, "base64:<key>" or "file:<path>"
+	Secret string `json:"secret,omitempty" yaml:"secret,omitempty"`
+	// Headers claim ( sub, uuid, roles, iss, aud, jti, name, auth_type ) to header name
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+}
+
+// forwardClaims values of the claims that can be forwarded
+var forwardClaims = map[string]func(claims *AuthClaims) string{
+	"sub": func(claims *AuthClaims) string { return claims.Subject },
+	"iss": func(claims *AuthClaims) string { return claims.Issuer },
+	"aud": func(claims *AuthClaims) string { return claims.Audience },
+	"jti": func(claims *AuthClaims) string { return claims.Id },
+	"uuid": func(claims *AuthClaims) string {
+		if claims.Details == nil {
+			return ""
+		}
+		return claims.Details.UUID
+	},
+	"roles": func(claims *AuthClaims) string {
+		if claims.Details == nil {
+			return ""
+		}
+		return formatForwardedRoles(claims.Details.Roles)
+	},
+	"name": func(claims *AuthClaims) string {
+		if claims.Details == nil {
+			return ""
+		}
+		return claims.Details.Name
+	},
+	"auth_type": func(claims *AuthClaims) string {
+		if claims.Details == nil {
+			return ""
+		}
+		return claims.Details.AuthType
+	},
+}
+
+// formatForwardedRoles comma separated, each role query escaped so a comma in a role stays in it
+func formatForwardedRoles(roles []string) string {
+	escaped := make([]string, 0, len(roles))
+	for _, role := range roles {
+		escaped = append(escaped, url.QueryEscape(role))
+	}
+	return strings.Join(escaped, ",")
+}
+
+// ParseForwardedRoles the roles of a forwarded roles header, on the upstream side
+func ParseForwardedRoles(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var roles []string
+	for _, escaped := range strings.Split(value, ",") {
+		role, err := url.QueryUnescape(escaped)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+// LoadProxyConfig read a json ( .json ) or yaml ( any other extension ) proxy config file
+func LoadProxyConfig(path string) (*ProxyConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &ProxyConfig{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(raw, cfg)
+	} else {
+		err = yaml.Unmarshal(raw, cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// TokenProxy reverse proxy that only lets verified requests through
+type TokenProxy struct {
+	verifier   VerifierServiceCreator
+	extractors []Extractor // token sources of the config, when the verifier doesn't tell its own
+	proxy      *httputil.ReverseProxy
+	routes     []ProxyRoute
+	secret     []byte
+	headers    map[string]string
+}
+
+// NewTokenProxy ...
+func NewTokenProxy(verifier VerifierServiceCreator, cfg *ProxyConfig) (*TokenProxy, error) {
+	if cfg == nil || cfg.Upstream == "" {
+		return nil, ErrMissingUpstream
+	}
+	upstream, err := url.Parse(cfg.Upstream)
+	if err != nil {
+		return nil, fmt.Errorf("upstream: %w", err)
+	}
+	opts, err := cfg.Verifier.Options()
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := forwardHeaders(cfg.Forward.Headers)
+	if err != nil {
+		return nil, err
+	}
+	p := &TokenProxy{
+		verifier:   verifier,
+		extractors: opts.extractors(),
+		proxy:      httputil.NewSingleHostReverseProxy(upstream),
+		routes:     sortRoutes(cfg.Routes),
+		headers:    headers,
+	}
+	// sign once the upstream path is final ( its base path joined )
+	director := p.proxy.Director
+	p.proxy.Director = func(r *http.Request) {
+		director(r)
+		p.signForwarded(r)
+	}
+	if len(p.headers) > 0 {
+		secret, err := resolveKey(cfg.Forward.Secret, "")
+		if err != nil {
+			return nil, fmt.Errorf("forward secret: %w", err)
+		}
+		if secret == "" {
+			return nil, ErrMissingForwardSecret
+		}
+		p.secret = []byte(secret)
+	}
+	return p, nil
+}
+
+// forwardHeaders check the claims and canonicalize the header names
+func forwardHeaders(headers map[string]string) (map[string]string, error) {
+	out := make(map[string]string, len(headers))
+	for claim, header := range headers {
+		if _, ok := forwardClaims[claim]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownForwardClaim, claim)
+		}
+		out[claim] = http.CanonicalHeaderKey(header)
+	}
+	return out, nil
+}
+
+// sortRoutes longest prefix first, method specific before the catch-all of the same prefix
+func sortRoutes(routes []ProxyRoute) []ProxyRoute {
+	out := append([]ProxyRoute(nil), routes...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if len(out[i].Prefix) != len(out[j].Prefix) {
+			return len(out[i].Prefix) > len(out[j].Prefix)
+		}
+		return len(out[i].Methods) > 0 && len(out[j].Methods) == 0
+	})
+	return out
+}
+
+// allowedRoute the roles of the most specific route, paths without a route only need a valid token.
+// The path must be a cleanPath one.
+func allowedRoute(routes []ProxyRoute, method, path string, claims *AuthClaims) bool {
+	for _, route := range routes {
+		if !route.matchPrefix(path) || !route.matchMethod(method) {
+			continue
+		}
+		return len(route.Roles) == 0 || claims.HasAnyRole(route.Roles...)
+	}
+	return true
+}
+
+// cleanPath the path routes are matched on and forwarded with, dot segments resolved.
+// Encoded dots, slashes and backslashes are refused: the upstream could decode them after the check.
+func cleanPath(u *url.URL) (string, error) {
+	escaped := strings.ToLower(u.EscapedPath())
+	for _, encoded := range []string{"%2e", "%2f", "%5c"} {
+		if strings.Contains(escaped, encoded) {
+			return "", ErrInvalidPath
+		}
+	}
+	raw := u.Path
+	if raw == "" {
+		raw = "/"
+	}
+	if !strings.HasPrefix(raw, "/") || strings.Contains(raw, "\\") {
+		return "", ErrInvalidPath
+	}
+	cleaned := path.Clean(raw)
+	if strings.HasSuffix(raw, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned, nil
+}
+
+// matchPrefix /admin/ ( or /admin ) matches /admin and /admin/..., not /administrator
+func (route ProxyRoute) matchPrefix(path string) bool {
+	prefix := strings.TrimSuffix(route.Prefix, "/")
+	if len(path) < len(prefix) || !strings.EqualFold(path[:len(prefix)], prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || path[len(prefix)] == '/'
+}
+
+// matchMethod ...
+func (route ProxyRoute) matchMethod(method string) bool {
+	if len(route.Methods) == 0 {
+		return true
+	}
+	for _, m := range route.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP verify, check the roles, strip the token and forward
+func (p *TokenProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	claims, err := p.verifier.UnSign(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	routePath, err := cleanPath(r.URL)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if !allowedRoute(p.routes, r.Method, routePath, claims) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	out := r.Clone(r.Context())
+	out.URL.Path, out.URL.RawPath = routePath, ""
+	p.stripToken(out, p.findToken(r))
+	p.forwardClaims(out, claims)
+	p.proxy.ServeHTTP(w, out)
+}
+
+// findToken the token the verifier took, through its own token sources when it tells them
+func (p *TokenProxy) findToken(r *http.Request) string {
+	if finder, ok := p.verifier.(tokenFinder); ok {
+		return finder.findToken(r)
+	}
+	return firstToken(r, p.extractors)
+}
+
+// stripToken the upstream never sees the token, wherever the extractor found it
+func (p *TokenProxy) stripToken(r *http.Request, token string) {
+	if token == "" {
+		return
+	}
+	for name, values := range r.Header {
+		if name == "Cookie" {
+			continue
+		}
+		for _, value := range values {
+			if strings.Contains(value, token) {
+				r.Header.Del(name)
+				break
+			}
+		}
+	}
+	query := r.URL.Query()
+	stripped := false
+	for name, values := range query {
+		for _, value := range values {
+			if strings.TrimSpace(value) == token {
+				query.Del(name)
+				stripped = true
+				break
+			}
+		}
+	}
+	if stripped {
+		r.URL.RawQuery = query.Encode()
+	}
+	var kept []string
+	stripped = false
+	for _, cookie := range r.Cookies() {
+		if strings.TrimSpace(cookie.Value) == token {
+			stripped = true
+			continue
+		}
+		kept = append(kept, cookie.String())
+	}
+	if stripped {
+		r.Header.Del("Cookie")
+		if len(kept) > 0 {
+			r.Header.Set("Cookie", strings.Join(kept, "; "))
+		}
+	}
+}
+
+// forwardClaims set the claim headers, client supplied ones are dropped first
+func (p *TokenProxy) forwardClaims(r *http.Request, claims *AuthClaims) {
+	for _, header := range p.headers {
+		r.Header.Del(header)
+	}
+	r.Header.Del(DefaultSignatureHeader)
+	r.Header.Del(DefaultSignedHeadersHeader)
+	r.Header.Del(DefaultTimestampHeader)
+	if len(p.headers) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(p.headers))
+	for claim, header := range p.headers {
+		r.Header.Set(header, forwardClaims[claim](claims))
+		names = append(names, header)
+	}
+	sort.Strings(names)
+	r.Header.Set(DefaultTimestampHeader, strconv.FormatInt(time.Now().Unix(), 10))
+	r.Header.Set(DefaultSignedHeadersHeader, strings.ToLower(strings.Join(names, ",")))
+}
+
+// signForwarded sign the claim headers with the path actually sent upstream
+func (p *TokenProxy) signForwarded(r *http.Request) {
+	if len(p.headers) == 0 {
+		return
+	}
+	names := make([]string, 0, len(p.headers))
+	for _, header := range p.headers {
+		names = append(names, header)
+	}
+	sort.Strings(names)
+	r.Header.Set(DefaultSignatureHeader, forwardSignature(p.secret, r, names, r.Header.Get(DefaultTimestampHeader)))
+}
+
+// VerifyForwardedHeaders check on the upstream side the headers signed by the TokenProxy
+func VerifyForwardedHeaders(r *http.Request, secret []byte, maxAge time.Duration) error {
+	timestamp := r.Header.Get(DefaultTimestampHeader)
+	signed, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidForwardSignature
+	}
+	if maxAge > 0 && time.Since(time.Unix(signed, 0)) > maxAge {
+		return ErrInvalidForwardSignature
+	}
+	var names []string
+	for _, name := range strings.Split(r.Header.Get(DefaultSignedHeadersHeader), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, http.CanonicalHeaderKey(name))
+		}
+	}
+	sort.Strings(names)
+	expected := forwardSignature(secret, r, names, timestamp)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(DefaultSignatureHeader))) {
+		return ErrInvalidForwardSignature
+	}
+	return nil
+}
+
+// forwardSignature hmac-sha256 over the timestamp, method, path, raw query and the signed headers
+func forwardSignature(secret []byte, r *http.Request, names []string, timestamp string) string {
+	var b strings.Builder
+	b.WriteString(timestamp + "\n" + r.Method + "\n" + r.URL.Path + "\n" + r.URL.RawQuery + "\n")
+	for _, name := range names {
+		b.WriteString(strings.ToLower(name) + ":" + r.Header.Get(name) + "\n")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(b.String()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
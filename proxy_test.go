@@ -0,0 +1,266 @@
+package authorizer_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+	"github.com/bayugyug/authorizer/authorizertest"
+)
+
+var _ = Describe("TokenProxy", func() {
+
+	var (
+		upstream *httptest.Server
+		seen     *http.Request
+		verifier *authorizer.VerifierService
+		tokens   *authorizertest.TokenFactory
+		proxy    http.Handler
+		secret   = "ci-forward-secret"
+		keys     authorizertest.KeyPair
+	)
+
+	BeforeEach(func() {
+		upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = r.Clone(r.Context())
+			w.WriteHeader(http.StatusOK)
+		}))
+		DeferCleanup(upstream.Close)
+		seen = nil
+
+		keys = authorizertest.NewRSAKeyPair(GinkgoT(), 2048)
+		var err error
+		verifier, err = authorizer.New(
+			authorizer.WithKeys(keys.PrivateKey, keys.PublicKey),
+			authorizer.WithTokenSource(authorizer.TokenSource{AuthBearer: true, QueryKey: "_verify"}),
+		)
+		Expect(err).To(BeNil())
+		tokens = authorizertest.NewTokenFactory(GinkgoT(), verifier)
+
+		bearer := true
+		proxy, err = authorizer.NewTokenProxy(verifier, &authorizer.ProxyConfig{
+			Upstream: upstream.URL,
+			Verifier: authorizer.Config{
+				TokenSource: authorizer.ConfigTokenSource{AuthBearer: &bearer, QueryKey: "_verify"},
+			},
+			Routes: []authorizer.ProxyRoute{
+				{Prefix: "/admin/", Roles: []string{"admin"}},
+				{Prefix: "/admin/public/"},
+			},
+			Forward: authorizer.ProxyForward{
+				Secret: secret,
+				Headers: map[string]string{
+					"sub":   "X-Auth-Subject",
+					"uuid":  "X-Auth-UUID",
+					"roles": "X-Auth-Roles",
+				},
+			},
+		})
+		Expect(err).To(BeNil())
+	})
+
+	serve := func(req *http.Request) int {
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	Context("Verified request is forwarded with signed claims", func() {
+		It("Prepare", func() {
+
+			req := authorizertest.NewRequest(http.MethodGet, "/orders?page=2", nil, authorizer.TokenSource{AuthBearer: true},
+				tokens.Valid(authorizertest.WithSubject("user-1001"), authorizertest.WithRoles("user", "auditor")))
+			req.Header.Set("X-Auth-Roles", "admin") // spoofed by the client
+			Expect(serve(req)).To(Equal(http.StatusOK))
+
+			Expect(seen).NotTo(BeNil())
+			Expect(seen.Header.Get("Authorization")).To(BeEmpty())
+			Expect(seen.URL.Query().Get("page")).To(Equal("2"))
+			Expect(seen.Header.Get("X-Auth-Subject")).To(Equal("user-1001"))
+			Expect(seen.Header.Get("X-Auth-UUID")).To(Equal("authorizertest-uuid"))
+			Expect(seen.Header.Get("X-Auth-Roles")).To(Equal("user,auditor"))
+			Expect(authorizer.VerifyForwardedHeaders(seen, []byte(secret), time.Minute)).To(Succeed())
+
+			seen.Header.Set("X-Auth-Roles", "admin")
+			Expect(authorizer.VerifyForwardedHeaders(seen, []byte(secret), time.Minute)).To(MatchError(authorizer.ErrInvalidForwardSignature))
+			seen.Header.Set("X-Auth-Roles", "user,auditor")
+
+			By("the query is signed too")
+			replayed := seen.Clone(seen.Context())
+			replayed.URL.RawQuery = "page=2&delete=all"
+			Expect(authorizer.VerifyForwardedHeaders(replayed, []byte(secret), time.Minute)).To(MatchError(authorizer.ErrInvalidForwardSignature))
+
+			By("Verified request is forwarded with signed claims ok")
+		})
+	})
+
+	Context("Roles with a comma", func() {
+		It("Prepare", func() {
+
+			req := authorizertest.NewRequest(http.MethodGet, "/orders", nil, authorizer.TokenSource{AuthBearer: true},
+				tokens.Valid(authorizertest.WithRoles("user,admin", "auditor")))
+			Expect(serve(req)).To(Equal(http.StatusOK))
+			Expect(seen.Header.Get("X-Auth-Roles")).To(Equal("user%2Cadmin,auditor"))
+			roles, err := authorizer.ParseForwardedRoles(seen.Header.Get("X-Auth-Roles"))
+			Expect(err).To(BeNil())
+			Expect(roles).To(Equal([]string{"user,admin", "auditor"}))
+
+			roles, err = authorizer.ParseForwardedRoles("")
+			Expect(err).To(BeNil())
+			Expect(roles).To(BeEmpty())
+			_, err = authorizer.ParseForwardedRoles("a%zz")
+			Expect(err).NotTo(BeNil())
+
+			By("Roles with a comma ok")
+		})
+	})
+
+	Context("Query token is stripped", func() {
+		It("Prepare", func() {
+
+			req := authorizertest.NewRequest(http.MethodGet, "/orders?page=2", nil, authorizer.TokenSource{QueryKey: "_verify"}, tokens.Valid())
+			Expect(serve(req)).To(Equal(http.StatusOK))
+			Expect(seen.URL.Query().Has("_verify")).To(BeFalse())
+			Expect(seen.URL.Query().Get("page")).To(Equal("2"))
+
+			By("Query token is stripped ok")
+		})
+	})
+
+	Context("Roles per path", func() {
+		It("Prepare", func() {
+
+			src := authorizer.TokenSource{AuthBearer: true}
+			Expect(serve(authorizertest.NewRequest(http.MethodGet, "/admin/users", nil, src, tokens.Valid()))).To(Equal(http.StatusForbidden))
+			Expect(serve(authorizertest.NewRequest(http.MethodGet, "/admin/users", nil, src, tokens.Valid(authorizertest.WithRoles("admin"))))).To(Equal(http.StatusOK))
+			Expect(serve(authorizertest.NewRequest(http.MethodGet, "/admin/public/faq", nil, src, tokens.Valid()))).To(Equal(http.StatusOK))
+
+			By("Roles per path ok")
+		})
+	})
+
+	Context("Routes match the cleaned path", func() {
+		It("Prepare", func() {
+
+			src := authorizer.TokenSource{AuthBearer: true}
+			user := tokens.Valid(authorizertest.WithRoles("user"))
+			for _, target := range []string{"/admin", "/admin/x", "/public/../admin/x", "/ADMIN/x", "/Admin/./x", "//admin/x"} {
+				Expect(serve(authorizertest.NewRequest(http.MethodGet, target, nil, src, user))).To(Equal(http.StatusForbidden), target)
+			}
+			for _, target := range []string{"/public/%2e%2e/admin/x", "/public/%2E%2E/admin/x", "/admin%2fx"} {
+				Expect(serve(authorizertest.NewRequest(http.MethodGet, target, nil, src, user))).To(Equal(http.StatusBadRequest), target)
+			}
+			Expect(seen).To(BeNil())
+
+			// whole segments only
+			Expect(serve(authorizertest.NewRequest(http.MethodGet, "/administrator", nil, src, user))).To(Equal(http.StatusOK))
+
+			// the upstream gets the cleaned path
+			Expect(serve(authorizertest.NewRequest(http.MethodGet, "/orders/./1001/../1002", nil, src, user))).To(Equal(http.StatusOK))
+			Expect(seen.URL.Path).To(Equal("/orders/1002"))
+			Expect(authorizer.VerifyForwardedHeaders(seen, []byte(secret), time.Minute)).To(Succeed())
+
+			By("Routes match the cleaned path ok")
+		})
+	})
+
+	Context("Token of a custom extractor is stripped", func() {
+		It("Prepare", func() {
+
+			withCookie, err := authorizer.New(
+				authorizer.WithKeys(keys.PrivateKey, keys.PublicKey),
+				authorizer.WithExtractors(authorizer.FromCookie("session")),
+			)
+			Expect(err).To(BeNil())
+			cookieProxy, err := authorizer.NewTokenProxy(withCookie, &authorizer.ProxyConfig{Upstream: upstream.URL})
+			Expect(err).To(BeNil())
+
+			req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			req.AddCookie(&http.Cookie{Name: "session", Value: tokens.Valid()})
+			req.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+			w := httptest.NewRecorder()
+			cookieProxy.ServeHTTP(w, req)
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			_, err = seen.Cookie("session")
+			Expect(err).To(MatchError(http.ErrNoCookie))
+			theme, err := seen.Cookie("theme")
+			Expect(err).To(BeNil())
+			Expect(theme.Value).To(Equal("dark"))
+
+			By("Token of a custom extractor is stripped ok")
+		})
+	})
+
+	Context("Signed with the upstream base path", func() {
+		It("Prepare", func() {
+
+			based, err := authorizer.NewTokenProxy(verifier, &authorizer.ProxyConfig{
+				Upstream: upstream.URL + "/api",
+				Forward: authorizer.ProxyForward{
+					Secret:  secret,
+					Headers: map[string]string{"sub": "X-Auth-Subject"},
+				},
+			})
+			Expect(err).To(BeNil())
+			req := authorizertest.NewRequest(http.MethodGet, "/orders", nil, authorizer.TokenSource{AuthBearer: true}, tokens.Valid())
+			w := httptest.NewRecorder()
+			based.ServeHTTP(w, req)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(seen.URL.Path).To(Equal("/api/orders"))
+			Expect(authorizer.VerifyForwardedHeaders(seen, []byte(secret), time.Minute)).To(Succeed())
+
+			By("Signed with the upstream base path ok")
+		})
+	})
+
+	Context("Rejected tokens never reach the upstream", func() {
+		It("Prepare", func() {
+
+			src := authorizer.TokenSource{AuthBearer: true}
+			for _, token := range []string{"", tokens.Expired(), tokens.WrongKey()} {
+				Expect(serve(authorizertest.NewRequest(http.MethodGet, "/orders", nil, src, token))).To(Equal(http.StatusUnauthorized))
+			}
+			Expect(seen).To(BeNil())
+
+			By("Rejected tokens never reach the upstream ok")
+		})
+	})
+
+	Context("Config file", func() {
+		It("Prepare", func() {
+
+			dir := GinkgoT().TempDir()
+			raw, err := json.Marshal(map[string]interface{}{
+				"upstream": upstream.URL,
+				"verifier": map[string]interface{}{"public_key": keys.PublicKey, "token_source": map[string]interface{}{"auth_bearer": true}},
+				"forward":  map[string]interface{}{"headers": map[string]string{"sub": "X-Auth-Subject"}},
+			})
+			Expect(err).To(BeNil())
+			path := filepath.Join(dir, "authproxy.json")
+			Expect(os.WriteFile(path, raw, 0o600)).To(Succeed())
+
+			cfg, err := authorizer.LoadProxyConfig(path)
+			Expect(err).To(BeNil())
+			_, err = authorizer.NewTokenProxy(verifier, cfg)
+			Expect(err).To(MatchError(authorizer.ErrMissingForwardSecret))
+
+			cfg.Forward.Headers["password"] = "X-Auth-Password"
+			cfg.Forward.Secret = secret
+			_, err = authorizer.NewTokenProxy(verifier, cfg)
+			Expect(err).To(MatchError(authorizer.ErrUnknownForwardClaim))
+
+			_, err = authorizer.NewTokenProxy(verifier, &authorizer.ProxyConfig{})
+			Expect(err).To(MatchError(authorizer.ErrMissingUpstream))
+
+			By("Config file ok")
+		})
+	})
+})
@@ -0,0 +1,76 @@
+package authorizer
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// RevocationChecker report if a verified token was revoked ( ie: by jti or subject )
+type RevocationChecker interface {
+	IsRevoked(claims *jwt.StandardClaims) (bool, error)
+}
+
+// RevocationCheckerFunc ...
+type RevocationCheckerFunc func(claims *jwt.StandardClaims) (bool, error)
+
+// IsRevoked ...
+func (f RevocationCheckerFunc) IsRevoked(claims *jwt.StandardClaims) (bool, error) {
+	return f(claims)
+}
+
+// RevocationList in-memory list of revoked token ids ( jti ), the ids are dropped once their expiry passed
+type RevocationList struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	expiry  expiryHeap
+}
+
+// NewRevocationList ...
+func NewRevocationList() *RevocationList {
+	return &RevocationList{
+		revoked: make(map[string]time.Time),
+	}
+}
+
+// Revoke the token id until its expiry, a zero time keeps it forever
+func (l *RevocationList) Revoke(id string, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.purge()
+	l.revoked[id] = until
+	if !until.IsZero() {
+		heap.Push(&l.expiry, expiryEntry{key: id, until: until})
+	}
+}
+
+// IsRevoked ...
+func (l *RevocationList) IsRevoked(claims *jwt.StandardClaims) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.purge()
+	until, ok := l.revoked[claims.Id]
+	if !ok {
+		return false, nil
+	}
+	return until.IsZero() || time.Now().Before(until), nil
+}
+
+// Len the ids still revoked
+func (l *RevocationList) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.purge()
+	return len(l.revoked)
+}
+
+// purge the expired ids, unless revoked again with another expiry
+func (l *RevocationList) purge() {
+	l.expiry.popExpired(time.Now(), func(entry expiryEntry) {
+		if until, ok := l.revoked[entry.key]; ok && until.Equal(entry.until) {
+			delete(l.revoked, entry.key)
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package authorizer
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// signedURLType typ header of the signed url tokens
+	signedURLType = "url+jwt"
+)
+
+var (
+	// ErrMissingQueryKey ...
+	ErrMissingQueryKey = errors.New("missing token source query key")
+	// ErrSignedURLToken ...
+	ErrSignedURLToken = errors.New("signed url token is only valid for its url")
+	// ErrURLMismatch ...
+	ErrURLMismatch = errors.New("signed url does not match the request")
+)
+
+// signedURLClaims the claims bound to the method, path and query of a url
+type signedURLClaims[T any] struct {
+	Claims[T]
+	URLHash string `json:"url_hash"`
+}
+
+// SignURL a GET link carrying a token in the TokenSource.QueryKey parameter, see SignURLFor
+func (s *TypedVerifierService[T]) SignURL(rawURL string, ttl time.Duration, claims *Claims[T]) (string, error) {
+	return s.SignURLFor(http.MethodGet, rawURL, ttl, claims)
+}
+
+// SignURLFor a link valid for ttl and only for the method, the path and the other query parameters.
+// The token can't be used as a bearer token ( Verify/UnSign reject it ), check it with VerifyURL.
+func (s *TypedVerifierService[T]) SignURLFor(method, rawURL string, ttl time.Duration, claims *Claims[T]) (string, error) {
+	key := s.opts.TokenSource.QueryKey
+	if key == "" {
+		return "", ErrMissingQueryKey
+	}
+	if claims == nil {
+		claims = &Claims[T]{}
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Del(key)
+	u.RawQuery = query.Encode()
+
+	payload, err := s.prepare(claims, SignOptions{TTL: ttl})
+	if err != nil {
+		return "", err
+	}
+	tokenStr, err := s.signToken(&signedURLClaims[T]{
+		Claims:  *payload,
+		URLHash: urlHash(method, u, key),
+	}, map[string]interface{}{"typ": signedURLType})
+	if err != nil {
+		return "", err
+	}
+
+	query.Set(key, tokenStr)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// VerifyURL check the token of a link made by SignURL/SignURLFor against the request
+func (s *TypedVerifierService[T]) VerifyURL(r *http.Request) (*Claims[T], error) {
+	key := s.opts.TokenSource.QueryKey
+	if key == "" {
+		return nil, ErrMissingQueryKey
+	}
+	tokenStr := r.URL.Query().Get(key)
+	if tokenStr == "" {
+		return nil, ErrEmptyToken
+	}
+	if s.opts.MaxTokenBytes > 0 && len(tokenStr) > s.opts.MaxTokenBytes {
+		return nil, ErrTokenTooLarge
+	}
+
+	token, err := jwt.ParseWithClaims(tokenStr, &signedURLClaims[T]{}, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["typ"] != signedURLType {
+			return nil, ErrInvalidToken
+		}
+		return s.verificationKey(token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	claims, ok := token.Claims.(*signedURLClaims[T])
+	if !ok {
+		return nil, ErrConvertClaims
+	}
+	if claims.URLHash != urlHash(r.Method, r.URL, key) {
+		return nil, ErrURLMismatch
+	}
+	if s.fieldsErr != nil {
+		return nil, s.fieldsErr
+	}
+	s.fields.decrypt(claims.Details)
+	return s.checkRevoked(&claims.Claims)
+}
+
+// urlHash sha256 of the method, the escaped path and the sorted query without the token
+func urlHash(method string, u *url.URL, key string) string {
+	query := u.Query()
+	query.Del(key)
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonical := strings.ToUpper(method) + "\n" + path + "\n" + query.Encode()
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
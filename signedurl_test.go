@@ -0,0 +1,124 @@
+package authorizer_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+	"github.com/bayugyug/authorizer/authorizertest"
+)
+
+var _ = Describe("SignedURL", func() {
+
+	var verifier *authorizer.VerifierService
+
+	BeforeEach(func() {
+		verifier = authorizertest.NewVerifier(GinkgoT())
+	})
+
+	request := func(method, link string) *http.Request {
+		return httptest.NewRequest(method, link, nil)
+	}
+
+	Context("Round trip", func() {
+		It("Prepare", func() {
+
+			link, err := verifier.SignURL("https://files.example.com/reports/2024.pdf?disposition=inline&v=2", time.Minute,
+				&authorizer.AuthClaims{Details: &authorizer.Details{UUID: "user-1001"}})
+			Expect(err).To(BeNil())
+			u, err := url.Parse(link)
+			Expect(err).To(BeNil())
+			Expect(u.Query().Get(authorizer.DefaultGetQueryParam)).NotTo(BeEmpty())
+
+			claims, err := verifier.VerifyURL(request(http.MethodGet, link))
+			Expect(err).To(BeNil())
+			Expect(claims.Details.UUID).To(Equal("user-1001"))
+			Expect(claims.ExpiresAt - claims.IssuedAt).To(BeEquivalentTo(60))
+
+			// query order does not matter
+			query := u.Query()
+			u.RawQuery = "v=2&" + authorizer.DefaultGetQueryParam + "=" + query.Get(authorizer.DefaultGetQueryParam) + "&disposition=inline"
+			_, err = verifier.VerifyURL(request(http.MethodGet, u.String()))
+			Expect(err).To(BeNil())
+
+			By("Round trip ok")
+		})
+	})
+
+	Context("Tampered links", func() {
+		It("Prepare", func() {
+
+			link, err := verifier.SignURLFor(http.MethodPut, "/uploads/avatar.png?size=small", time.Minute, nil)
+			Expect(err).To(BeNil())
+			_, err = verifier.VerifyURL(request(http.MethodPut, link))
+			Expect(err).To(BeNil())
+
+			u, _ := url.Parse(link)
+			token := u.Query().Get(authorizer.DefaultGetQueryParam)
+			for _, tampered := range []struct{ method, target string }{
+				{http.MethodGet, link},
+				{http.MethodPut, "/uploads/other.png?size=small&" + authorizer.DefaultGetQueryParam + "=" + token},
+				{http.MethodPut, "/uploads/avatar.png?size=large&" + authorizer.DefaultGetQueryParam + "=" + token},
+				{http.MethodPut, "/uploads/avatar.png?size=small&extra=1&" + authorizer.DefaultGetQueryParam + "=" + token},
+			} {
+				_, err = verifier.VerifyURL(request(tampered.method, tampered.target))
+				Expect(err).To(MatchError(authorizer.ErrURLMismatch), tampered.target)
+			}
+
+			_, err = verifier.VerifyURL(request(http.MethodGet, "/uploads/avatar.png"))
+			Expect(err).To(MatchError(authorizer.ErrEmptyToken))
+
+			By("Tampered links ok")
+		})
+	})
+
+	Context("Not a bearer token", func() {
+		It("Prepare", func() {
+
+			link, err := verifier.SignURL("/download/1", time.Minute, nil)
+			Expect(err).To(BeNil())
+
+			// the query token source would find it, still rejected
+			_, err = verifier.UnSign(request(http.MethodGet, link))
+			Expect(errors.Is(err, authorizer.ErrSignedURLToken)).To(BeTrue())
+
+			// and a bearer token is not a signed url
+			tokens := authorizertest.NewTokenFactory(GinkgoT(), verifier)
+			_, err = verifier.VerifyURL(request(http.MethodGet, "/download/1?"+authorizer.DefaultGetQueryParam+"="+tokens.Valid()))
+			Expect(errors.Is(err, authorizer.ErrInvalidToken)).To(BeTrue())
+
+			By("Not a bearer token ok")
+		})
+	})
+
+	Context("Expired and missing query key", func() {
+		It("Prepare", func() {
+
+			// exp of the claims wins over the ttl
+			expired, err := verifier.SignURL("/download/1", time.Minute, &authorizer.AuthClaims{
+				StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(-time.Hour).Unix()},
+			})
+			Expect(err).To(BeNil())
+			_, err = verifier.VerifyURL(request(http.MethodGet, expired))
+			Expect(err).To(HaveOccurred())
+
+			keys := authorizertest.NewRSAKeyPair(GinkgoT(), 2048)
+			bearerOnly, err := authorizer.New(authorizer.WithKeys(keys.PrivateKey, keys.PublicKey),
+				authorizer.WithTokenSource(authorizer.TokenSource{AuthBearer: true}))
+			Expect(err).To(BeNil())
+			_, err = bearerOnly.SignURL("/download/1", time.Minute, nil)
+			Expect(err).To(MatchError(authorizer.ErrMissingQueryKey))
+			_, err = bearerOnly.VerifyURL(request(http.MethodGet, expired))
+			Expect(err).To(MatchError(authorizer.ErrMissingQueryKey))
+
+			By("Expired and missing query key ok")
+		})
+	})
+})
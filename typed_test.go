@@ -0,0 +1,98 @@
+package authorizer_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bayugyug/authorizer"
+)
+
+type typedMeta struct {
+	Tenant string   `json:"tenant"`
+	Level  int      `json:"level"`
+	Tags   []string `json:"tags"`
+}
+
+var _ = Describe("TypedVerifier", func() {
+
+	var (
+		privKeyStr string
+		pubKeyStr  string
+	)
+
+	BeforeEach(func() {
+		privKeyStr, pubKeyStr = newKeyPair(2048)
+	})
+
+	Context("Sign and unsign typed meta info", func() {
+		It("Prepare", func() {
+
+			verifier := authorizer.NewTypedVerifierService[typedMeta](&authorizer.Options{
+				PrivateKey: privKeyStr,
+				PublicKey:  pubKeyStr,
+				TokenSource: authorizer.TokenSource{
+					QueryKey: "_verify",
+				},
+			})
+			Expect(verifier).NotTo(BeNil())
+
+			sign, err := verifier.Sign(&authorizer.Claims[typedMeta]{
+				StandardClaims: jwt.StandardClaims{
+					Subject: "user-1001",
+				},
+				MetaInfo: typedMeta{
+					Tenant: "acme",
+					Level:  3,
+					Tags:   []string{"a", "b"},
+				},
+				Details: &authorizer.Details{
+					Roles: []string{"admin"},
+				},
+			})
+			Expect(err).To(BeNil())
+
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/get?_verify=%s", url.QueryEscape(sign)), nil)
+			res, err := verifier.UnSign(req)
+			Expect(err).To(BeNil())
+			Expect(res.MetaInfo.Tenant).To(Equal("acme"))
+			Expect(res.MetaInfo.Level).To(Equal(3))
+			Expect(res.MetaInfo.Tags).To(Equal([]string{"a", "b"}))
+			Expect(res.Details.Roles).To(Equal([]string{"admin"}))
+
+			By("Sign and unsign typed meta info ok")
+		})
+	})
+
+	Context("Typed token read by the untyped service", func() {
+		It("Prepare", func() {
+
+			opts := &authorizer.Options{
+				PrivateKey: privKeyStr,
+				PublicKey:  pubKeyStr,
+				TokenSource: authorizer.TokenSource{
+					QueryKey: "_verify",
+				},
+			}
+			sign, err := authorizer.NewTypedVerifierService[typedMeta](opts).Sign(&authorizer.Claims[typedMeta]{
+				MetaInfo: typedMeta{Tenant: "acme"},
+			})
+			Expect(err).To(BeNil())
+
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/get?_verify=%s", url.QueryEscape(sign)), nil)
+			res, err := authorizer.NewVerifierService(opts).UnSign(req)
+			Expect(err).To(BeNil())
+			meta, ok := res.MetaInfo.(map[string]interface{})
+			Expect(ok).To(BeTrue())
+			Expect(meta["tenant"]).To(Equal("acme"))
+
+			By("Typed token read by the untyped service ok")
+		})
+	})
+})
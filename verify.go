@@ -1,71 +1,271 @@
 package authorizer
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
 	"net/http"
+	"runtime"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
-
-	"github.com/bayugyug/commons"
+	"github.com/google/uuid"
 )
 
 //go:generate mockgen -destination ./mock/mock_verifiersvccreator.go -package mock github.com/bayugyug/authorizer VerifierServiceCreator
 
 // VerifierServiceCreator  ...
 type VerifierServiceCreator interface {
-	Sign(payload *AuthClaims) (string, error)
+	Sign(payload *AuthClaims, opts ...SignOptions) (string, error)
 	UnSign(req *http.Request) (*AuthClaims, error)
 }
 
-// VerifierService  ...
-type VerifierService struct {
-	opts *Options
+// TokenVerifier verify a raw token
+type TokenVerifier interface {
+	Verify(tokenStr string) (*AuthClaims, error)
+}
+
+// BatchVerifier verify a raw token or several of them at once
+type BatchVerifier interface {
+	TokenVerifier
+	VerifyBatch(tokens []string) []VerifyResult[interface{}]
+}
+
+// verify the interfaces
+var (
+	_ VerifierServiceCreator = (*VerifierService)(nil)
+	_ BatchVerifier          = (*VerifierService)(nil)
+	_ VerifierServiceCreator = (*MultiVerifier)(nil)
+	_ BatchVerifier          = (*MultiVerifier)(nil)
+)
+
+// TypedVerifierService sign/un-sign claims with a typed MetaInfo
+type TypedVerifierService[T any] struct {
+	opts       *Options
+	extractors []Extractor
+	privateKey crypto.PrivateKey
+	privateErr error
+	method     jwt.SigningMethod
+	keyID      string // kid of the signed tokens, the JWKS thumbprint
+	publicKey  crypto.PublicKey
+	publicErr  error
+	cache      *tokenCache[T]
+	encKey     crypto.PublicKey  // nil when not encrypting
+	decKey     crypto.PrivateKey // nil when not decrypting
+	encErr     error
+	decErr     error
+	fields     *fieldCipher // nil without a field key
+	fieldsErr  error
 }
 
+// VerifierService  ...
+type VerifierService = TypedVerifierService[interface{}]
+
 // NewVerifierService create a service
 func NewVerifierService(opts *Options) VerifierServiceCreator {
-	// default
-	svc := &VerifierService{
-		opts: opts,
+	return NewTypedVerifierService[interface{}](opts)
+}
+
+// NewTypedVerifierService create a service for claims with a MetaInfo of type T
+func NewTypedVerifierService[T any](opts *Options) *TypedVerifierService[T] {
+	// own copy, the caller options are never touched
+	cfg := Options{}
+	if opts != nil {
+		cfg = *opts
+	}
+	svc := &TypedVerifierService[T]{
+		opts: &cfg,
 	}
 	if svc.opts.Expiry <= 0 {
 		svc.opts.Expiry = DefaultExpiry
 	}
+	svc.extractors = svc.opts.extractors()
+	if svc.opts.CacheSize > 0 {
+		svc.cache = newTokenCache[T](svc.opts.CacheSize, svc.opts.CacheTTL)
+	}
+
+	// parse the keys once, errors are reported on Sign/UnSign
+	svc.privateErr, svc.publicErr = ErrMissingPrivateKey, ErrMissingPublicKey
+	if strings.TrimSpace(svc.opts.PrivateKey) != "" {
+		svc.privateKey, svc.privateErr = ParsePrivateKey(formatKey(svc.opts.PrivateKey))
+	}
+	if svc.privateErr == nil {
+		svc.privateErr = svc.opts.checkKeyPolicy(svc.privateKey)
+	}
+	if svc.privateErr == nil {
+		svc.method, svc.privateErr = signingMethod(svc.privateKey)
+	}
+	if svc.privateErr == nil {
+		svc.privateErr = svc.opts.checkSigningMethod(svc.method)
+	}
+	if svc.privateErr == nil {
+		if jwk, err := newJSONWebKey(publicKeyOf(svc.privateKey)); err == nil {
+			svc.keyID = jwk.Kid
+		}
+	}
+	if strings.TrimSpace(svc.opts.PublicKey) != "" {
+		svc.publicKey, svc.publicErr = ParsePublicKey(formatKey(svc.opts.PublicKey))
+	}
+	if svc.publicErr == nil {
+		svc.publicErr = svc.opts.checkKeyPolicy(svc.publicKey)
+	}
+	if strings.TrimSpace(svc.opts.EncryptionKey) != "" {
+		svc.encKey, svc.encErr = ParsePublicKey(formatKey(svc.opts.EncryptionKey))
+		if svc.encErr == nil {
+			svc.encErr = svc.opts.checkKeyPolicy(svc.encKey)
+		}
+	}
+	if strings.TrimSpace(svc.opts.DecryptionKey) != "" {
+		svc.decKey, svc.decErr = ParsePrivateKey(formatKey(svc.opts.DecryptionKey))
+		if svc.decErr == nil {
+			svc.decErr = svc.opts.checkKeyPolicy(svc.decKey)
+		}
+	}
+	svc.fields, svc.fieldsErr = newFieldCipher(svc.opts.FieldKey, svc.opts.EncryptFields)
+	if svc.opts.BatchWorkers <= 0 {
+		svc.opts.BatchWorkers = runtime.GOMAXPROCS(0)
+	}
+	if svc.opts.MaxTokenBytes == 0 {
+		svc.opts.MaxTokenBytes = DefaultMaxTokenBytes
+	}
 	return svc
 }
 
-// Sign ... sign the payload
-func (s *VerifierService) Sign(payload *AuthClaims) (string, error) {
+// New create a validated service from functional options
+func New(opts ...Option) (*VerifierService, error) {
+	return NewTyped[interface{}](opts...)
+}
 
-	// new claims
-	if payload == nil {
-		return "", ErrMissingParams
+// NewTyped create a validated service for claims with a MetaInfo of type T
+func NewTyped[T any](opts ...Option) (*TypedVerifierService[T], error) {
+	cfg := Options{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
+	return NewTypedVerifierService[T](&cfg), nil
+}
 
-	// re calculate the secret-salt
-	if payload.Subject != "" {
-		payload.Subject = payload.SetSubject(payload.Subject)
+// Sign ... sign the payload ( a copy of it, the caller claims are left as is )
+func (s *TypedVerifierService[T]) Sign(claims *Claims[T], opts ...SignOptions) (string, error) {
+	payload, err := s.prepare(claims, opts...)
+	if err != nil {
+		return "", err
+	}
+	token, err := s.signToken(payload, nil)
+	if err != nil {
+		return "", err
 	}
+	return s.encrypt(token)
+}
+
+// encrypt nest the signed token in a JWE when an encryption key is set
+func (s *TypedVerifierService[T]) encrypt(token string) (string, error) {
+	if s.encErr != nil {
+		return "", s.encErr
+	}
+	if s.encKey == nil {
+		return token, nil
+	}
+	return encryptJWE([]byte(token), s.encKey, jweCtyJWT)
+}
+
+// decrypt the signed token of a nested JWT, plain signed tokens are returned as is
+func (s *TypedVerifierService[T]) decrypt(token string) (string, error) {
+	if !isJWE(token) {
+		return token, nil
+	}
+	if s.decErr != nil {
+		return "", s.decErr
+	}
+	if s.decKey == nil {
+		return "", ErrMissingDecryptionKey
+	}
+	plaintext, header, err := decryptJWE(token, s.decKey)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(header.Cty, jweCtyJWT) || isJWE(string(plaintext)) {
+		return "", fmt.Errorf("%w: not a nested signed token", ErrInvalidJWE)
+	}
+	return string(plaintext), nil
+}
+
+// prepare a copy of the claims with the defaults and the per call overrides
+func (s *TypedVerifierService[T]) prepare(claims *Claims[T], opts ...SignOptions) (*Claims[T], error) {
+
+	// new claims
+	if claims == nil {
+		return nil, ErrMissingParams
+	}
+	payload := *claims
+
+	// per call overrides
+	sopts := s.signOptions(opts...)
+	now := time.Now()
 
 	// set default
 	if payload.ExpiresAt == 0 {
-		payload.ExpiresAt = time.Now().Add(time.Duration(s.opts.Expiry) * time.Minute).Unix()
+		payload.ExpiresAt = now.Add(sopts.TTL).Unix()
+	}
+	if payload.IssuedAt == 0 {
+		payload.IssuedAt = now.Unix()
+	}
+	if payload.NotBefore == 0 {
+		payload.NotBefore = now.Unix()
+	}
+	if payload.Id == "" {
+		payload.Id = sopts.ID
+	}
+	if payload.Issuer == "" {
+		payload.Issuer = sopts.Issuer
+	}
+	if payload.Audience == "" {
+		payload.Audience = sopts.Audience
+	}
+
+	// salt the subject only when asked to ( after the iss/exp are final )
+	switch {
+	case sopts.Salt != "":
+		payload.Subject = payload.SetSubject(sopts.Salt)
+	case s.opts.SaltSubject && payload.Subject != "":
+		payload.Subject = payload.SetSubject(payload.Subject)
 	}
 
-	// parse private-key
-	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(
-		[]byte(commons.FormatConfigFromEnvt(s.opts.PrivateKey)),
-	)
+	// sensitive details, on a copy
+	if s.fieldsErr != nil {
+		return nil, s.fieldsErr
+	}
+	details, err := s.fields.encrypt(payload.Details)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	payload.Details = details
+
+	return &payload, nil
+}
+
+// signToken sign with RS256 or ES256/ES384/ES512 following the key, headers on top of alg/typ
+func (s *TypedVerifierService[T]) signToken(claims jwt.Claims, headers map[string]interface{}) (string, error) {
 
-	// sign with HS256
-	token := jwt.New(jwt.SigningMethodRS256)
-	token.Claims = payload
+	// private-key
+	if s.privateErr != nil {
+		return "", s.privateErr
+	}
+	token := jwt.NewWithClaims(s.method, claims)
+	if s.keyID != "" {
+		token.Header["kid"] = s.keyID
+	}
+	for k, v := range headers {
+		token.Header[k] = v
+	}
 
 	// sign
-	tokenString, err := token.SignedString(privateKey)
+	tokenString, err := token.SignedString(s.privateKey)
 	if err != nil {
 		return "", err
 	}
@@ -74,34 +274,79 @@ func (s *VerifierService) Sign(payload *AuthClaims) (string, error) {
 	return tokenString, nil
 }
 
-// UnSign ... verify the signed payload
-func (s *VerifierService) UnSign(req *http.Request) (*AuthClaims, error) {
-
-	var tokenStr string
-
-	// from bearer
-	if s.opts.TokenSource.AuthBearer {
-		tokenStr = GetTokenFromAuthBearer(req)
+// signOptions merge the per call overrides on top of the service defaults
+func (s *TypedVerifierService[T]) signOptions(opts ...SignOptions) SignOptions {
+	merged := SignOptions{
+		Issuer:   s.opts.Issuer,
+		Audience: s.opts.Audience,
+		TTL:      time.Duration(s.opts.Expiry) * time.Minute,
+	}
+	if s.opts.ExpiresIn > 0 {
+		merged.TTL = s.opts.ExpiresIn
 	}
-	// from header
-	if s.opts.TokenSource.HeaderKey != "" && len(tokenStr) <= 0 {
-		tokenStr = GetTokenFromHeader(req, s.opts.TokenSource.HeaderKey)
+	for _, o := range opts {
+		if o.Issuer != "" {
+			merged.Issuer = o.Issuer
+		}
+		if o.Audience != "" {
+			merged.Audience = o.Audience
+		}
+		if o.ID != "" {
+			merged.ID = o.ID
+		}
+		if o.TTL > 0 {
+			merged.TTL = o.TTL
+		}
+		if o.Salt != "" {
+			merged.Salt = o.Salt
+		}
 	}
-	// from get-query-string
-	if s.opts.TokenSource.QueryKey != "" && len(tokenStr) <= 0 {
-		tokenStr = GetTokenFromQuery(req, s.opts.TokenSource.QueryKey)
+	if merged.ID == "" {
+		merged.ID = uuid.New().String()
 	}
+	return merged
+}
+
+// UnSign ... verify the signed payload
+func (s *TypedVerifierService[T]) UnSign(req *http.Request) (*Claims[T], error) {
+
+	return s.Verify(s.findToken(req))
+}
+
+// findToken first source with a token wins
+func (s *TypedVerifierService[T]) findToken(req *http.Request) string {
+	return firstToken(req, s.extractors)
+}
+
+// Verify ... verify a raw token
+func (s *TypedVerifierService[T]) Verify(tokenStr string) (*Claims[T], error) {
 
 	// sanity
 	if tokenStr == "" {
 		return nil, ErrEmptyToken
 	}
+	if s.opts.MaxTokenBytes > 0 && len(tokenStr) > s.opts.MaxTokenBytes {
+		return nil, ErrTokenTooLarge
+	}
+
+	// seen it already
+	if s.cache != nil {
+		if claims, ok := s.cache.get(tokenStr); ok {
+			return s.checkRevoked(claims)
+		}
+	}
+
+	// nested JWT
+	signed, err := s.decrypt(tokenStr)
+	if err != nil {
+		return nil, err
+	}
 
 	// parse it
 	token, err := jwt.ParseWithClaims(
-		tokenStr,
-		&AuthClaims{},
-		GetPublicKey(commons.FormatConfigFromEnvt(s.opts.PublicKey)))
+		signed,
+		&Claims[T]{},
+		s.keyFunc)
 
 	// sanity
 	if err != nil {
@@ -113,12 +358,84 @@ func (s *VerifierService) UnSign(req *http.Request) (*AuthClaims, error) {
 	}
 
 	// convert
-	newClaims, ok := token.Claims.(*AuthClaims)
+	newClaims, ok := token.Claims.(*Claims[T])
 	if !ok {
 		return nil, ErrConvertClaims
 	}
 
+	// encrypted details
+	if s.fieldsErr != nil {
+		return nil, s.fieldsErr
+	}
+	s.fields.decrypt(newClaims.Details)
+
+	if s.cache != nil {
+		s.cache.add(tokenStr, newClaims)
+	}
+
 	// good ;-)
-	return newClaims, nil
+	return s.checkRevoked(newClaims)
+}
 
+// CacheStats hit/miss counters of the verified-token cache ( zero when disabled )
+func (s *TypedVerifierService[T]) CacheStats() CacheStats {
+	if s.cache == nil {
+		return CacheStats{}
+	}
+	return s.cache.snapshot()
+}
+
+// checkRevoked run the revocation check on every verification, cached or not
+func (s *TypedVerifierService[T]) checkRevoked(claims *Claims[T]) (*Claims[T], error) {
+	if s.opts.Revocation == nil {
+		return claims, nil
+	}
+	revoked, err := s.opts.Revocation.IsRevoked(&claims.StandardClaims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrRevokedToken
+	}
+	return claims, nil
+}
+
+// keyFunc the parsed public key, signed url tokens are only good for VerifyURL, ID tokens for the clients
+// and detached signatures for VerifyBytes
+func (s *TypedVerifierService[T]) keyFunc(token *jwt.Token) (interface{}, error) {
+	switch token.Header["typ"] {
+	case signedURLType:
+		return nil, ErrSignedURLToken
+	case idTokenType:
+		return nil, ErrIDToken
+	case detachedType:
+		return nil, ErrDetachedJWS
+	}
+	return s.verificationKey(token)
+}
+
+// verificationKey the parsed public key, the token method must be allowed and match its type
+func (s *TypedVerifierService[T]) verificationKey(token *jwt.Token) (interface{}, error) {
+	if s.publicErr != nil {
+		return nil, s.publicErr
+	}
+	if err := s.opts.checkTokenHeader(token); err != nil {
+		return nil, err
+	}
+	return methodKey(token, s.publicKey)
+}
+
+// methodKey the key when the token method matches its type
+func methodKey(token *jwt.Token, key crypto.PublicKey) (interface{}, error) {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); ok {
+			return key, nil
+		}
+	case *ecdsa.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodECDSA); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 }